@@ -0,0 +1,296 @@
+package banta
+
+import (
+	"math"
+	"sync"
+)
+
+// kinds of AltBars
+const (
+	AltRenko  = iota // 砖形图，价格越过上一砖块一个砖块大小时生成，反转需两个砖块
+	AltRange         // 最高最低价差达到Size时完成
+	AltTick          // 成交笔数达到Size时完成
+	AltVolume        // 成交量达到Size时完成
+	AltDollar        // 成交额达到Size时完成
+)
+
+/*
+AltBars build non-time bars from trades or klines, and send them to Env by OnBar2, so that all indicators
+and CGraph can run on them. Bars start at the time of their first trade, and end after their last trade,
+times are shifted forward slightly when several bars are finished by one trade, so that bar times are always
+increasing. Call indicators in Callback, since one input may finish several bars.
+
+Range, tick, volume and dollar bars are finished by the trade or kline which reaches Size, they are not split.
+Renko bricks are built from prices: trades, or open, low/high, high/low, close of klines; High/Low are
+the brick bounds, volume is added to the first brick finished.
+
+从逐笔成交或K线构建非时间K线，通过OnBar2发送到Env，可在其上运行所有指标和CGraph。
+K线开始于首笔成交时间，结束于最后一笔成交之后；一次输入完成多个K线时时间略微后移，保证K线时间递增。
+一次输入可能完成多个K线，指标应在Callback中计算。
+范围、笔数、成交量、成交额K线在达到Size的成交或K线处完成，不拆分。砖形图按价格构建：逐笔成交价，
+或K线的开、低/高、高/低、收；高低价为砖块边界，成交量计入首个完成的砖块
+*/
+type AltBars struct {
+	Env      *BarEnv
+	Kind     int
+	Size     float64         // 砖块大小/价格范围/笔数/成交量/成交额
+	ATRLen   int             // 大于0时砖块大小为输入K线的ATR，仅用于砖形图
+	Callback func(e *BarEnv) // 每个K线完成后调用，不可在其中调用AltBars的方法
+	bar      Kline           // 正在形成的K线，砖形图中为尚未计入砖块的成交
+	endMS    int64           // 正在形成的K线最后成交的结束时间
+	active   bool
+	top      float64 // 最近砖块的上下边界
+	bottom   float64
+	atr      atrState
+	lock     sync.Mutex
+}
+
+// atrState compute ATR of input klines by RMA
+type atrState struct {
+	prevClose float64
+	sumTR     float64
+	num       int
+	val       float64
+}
+
+/*
+NewRenkoBars create Renko bars with fixed box size
+
+创建固定砖块大小的砖形图
+*/
+func NewRenkoBars(env *BarEnv, box float64) *AltBars {
+	return newAltBars(env, AltRenko, box)
+}
+
+/*
+NewRenkoATR create Renko bars whose box size is the ATR of input klines, no bricks before ATR is ready
+
+创建砖块大小为输入K线ATR的砖形图，ATR计算完成前不生成砖块
+*/
+func NewRenkoATR(env *BarEnv, period int) *AltBars {
+	res := newAltBars(env, AltRenko, math.NaN())
+	res.ATRLen = period
+	return res
+}
+
+/*
+NewRangeBars create bars which are finished when high - low reaches size
+
+创建最高最低价差达到size时完成的K线
+*/
+func NewRangeBars(env *BarEnv, size float64) *AltBars {
+	return newAltBars(env, AltRange, size)
+}
+
+/*
+NewTickBars create bars of num trades, TradeNum is used for klines, or 1 if it's 0
+
+创建每num笔成交的K线，K线输入使用TradeNum，为0时计为1
+*/
+func NewTickBars(env *BarEnv, num int) *AltBars {
+	return newAltBars(env, AltTick, float64(num))
+}
+
+/*
+NewVolumeBars create bars which are finished when volume reaches size
+
+创建成交量达到size时完成的K线
+*/
+func NewVolumeBars(env *BarEnv, size float64) *AltBars {
+	return newAltBars(env, AltVolume, size)
+}
+
+/*
+NewDollarBars create bars which are finished when quote volume reaches size, Volume * Close is used for
+klines without QuoteVolume
+
+创建成交额达到size时完成的K线，K线没有QuoteVolume时使用Volume * Close
+*/
+func NewDollarBars(env *BarEnv, size float64) *AltBars {
+	return newAltBars(env, AltDollar, size)
+}
+
+func newAltBars(env *BarEnv, kind int, size float64) *AltBars {
+	return &AltBars{Env: env, Kind: kind, Size: size, top: math.NaN(), bottom: math.NaN(),
+		atr: atrState{prevClose: math.NaN(), val: math.NaN()}}
+}
+
+/*
+OnTrade add a trade, trades should be in time order
+
+添加一笔成交，成交需按时间顺序
+*/
+func (b *AltBars) OnTrade(tr *Trade) {
+	k := &Kline{Time: tr.Time, Open: tr.Price, High: tr.Price, Low: tr.Price, Close: tr.Price, Volume: tr.Size,
+		Info: math.NaN(), QuoteVolume: tr.Price * tr.Size, TradeNum: 1}
+	if tr.IsBuy {
+		k.BuyVolume = tr.Size
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.Kind == AltRenko {
+		b.merge(k, tr.Time+1)
+		b.renko(tr.Price, tr.Time, tr.Time+1)
+		return
+	}
+	b.add(k, tr.Time+1)
+}
+
+/*
+OnKline add a finished kline such as 1m, endMS is its end time
+
+添加一个已完成的K线（如1m），endMS为其结束时间
+*/
+func (b *AltBars) OnKline(k *Kline, endMS int64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.Kind != AltRenko {
+		b.add(k, endMS)
+		return
+	}
+	b.merge(k, endMS)
+	prices := []float64{k.Open, k.Low, k.High, k.Close}
+	if k.Close < k.Open {
+		prices[1], prices[2] = k.High, k.Low
+	}
+	for _, p := range prices {
+		b.renko(p, k.Time, endMS)
+	}
+	if b.ATRLen > 0 {
+		b.Size = b.atr.update(k, b.ATRLen)
+	}
+}
+
+/*
+FormingBar return a copy of the unfinished bar, nil if not exist
+
+返回未完成的K线，不存在时返回nil
+*/
+func (b *AltBars) FormingBar() *Kline {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !b.active {
+		return nil
+	}
+	bar := b.bar
+	return &bar
+}
+
+// merge add k to the forming bar
+func (b *AltBars) merge(k *Kline, endMS int64) {
+	b.endMS = endMS
+	if !b.active {
+		b.bar = *k
+		b.active = true
+		return
+	}
+	bar := &b.bar
+	bar.High = max(bar.High, k.High)
+	bar.Low = min(bar.Low, k.Low)
+	bar.Close = k.Close
+	bar.Volume = addNaN(bar.Volume, k.Volume)
+	bar.QuoteVolume = addNaN(bar.QuoteVolume, k.QuoteVolume)
+	bar.TradeNum = addNaN(bar.TradeNum, k.TradeNum)
+	bar.BuyVolume = addNaN(bar.BuyVolume, k.BuyVolume)
+	if !math.IsNaN(k.Info) {
+		bar.Info = k.Info
+	}
+}
+
+// add merge k for range, tick, volume and dollar bars, and finish the bar when it's full
+func (b *AltBars) add(k *Kline, endMS int64) {
+	if b.Kind == AltTick && !(k.TradeNum > 0) {
+		dup := *k
+		dup.TradeNum = 1
+		k = &dup
+	}
+	if b.Kind == AltDollar && !(k.QuoteVolume > 0) {
+		dup := *k
+		dup.QuoteVolume = k.Volume * k.Close
+		k = &dup
+	}
+	b.merge(k, endMS)
+	bar := &b.bar
+	var full bool
+	switch b.Kind {
+	case AltRange:
+		full = bar.High-bar.Low >= b.Size
+	case AltTick:
+		full = bar.TradeNum >= b.Size
+	case AltVolume:
+		full = bar.Volume >= b.Size
+	case AltDollar:
+		full = bar.QuoteVolume >= b.Size
+	}
+	if full {
+		b.active = false
+		b.emit(b.bar, b.endMS)
+	}
+}
+
+// renko add bricks when price moves beyond the last brick by box size
+func (b *AltBars) renko(price float64, ms, endMS int64) {
+	if math.IsNaN(b.top) {
+		b.top, b.bottom = price, price
+	}
+	box := b.Size
+	if !(box > 0) {
+		// ATR未就绪
+		return
+	}
+	for {
+		var open, close float64
+		if price >= b.top+box {
+			open, close = b.top, b.top+box
+		} else if price <= b.bottom-box {
+			open, close = b.bottom, b.bottom-box
+		} else {
+			return
+		}
+		brick := Kline{Time: ms, Open: open, High: max(open, close), Low: min(open, close), Close: close,
+			Info: math.NaN()}
+		if b.active {
+			// 未计入砖块的成交量计入首个砖块
+			p := b.bar
+			brick.Time, brick.Volume, brick.QuoteVolume = p.Time, p.Volume, p.QuoteVolume
+			brick.TradeNum, brick.BuyVolume, brick.Info = p.TradeNum, p.BuyVolume, p.Info
+			b.active = false
+		}
+		b.top, b.bottom = brick.High, brick.Low
+		b.emit(brick, endMS)
+	}
+}
+
+// emit send a finished bar to Env, times are adjusted to be after the last bar
+func (b *AltBars) emit(bar Kline, endMS int64) {
+	e := b.Env
+	start := max(bar.Time, e.TimeStop)
+	endMS = max(endMS, start+1)
+	e.extBar = &bar
+	e.OnBar2(start, endMS, bar.Open, bar.High, bar.Low, bar.Close, bar.Volume, bar.Info)
+	if b.Callback != nil {
+		b.Callback(e)
+	}
+}
+
+// update add a kline and return the latest ATR, NaN before period klines
+func (a *atrState) update(k *Kline, period int) float64 {
+	tr := k.High - k.Low
+	if !math.IsNaN(a.prevClose) {
+		tr = max(tr, math.Abs(k.High-a.prevClose), math.Abs(k.Low-a.prevClose))
+	}
+	a.prevClose = k.Close
+	if math.IsNaN(tr) {
+		return a.val
+	}
+	a.num += 1
+	if a.num <= period {
+		a.sumTR += tr
+		if a.num == period {
+			a.val = a.sumTR / float64(period)
+		}
+	} else {
+		a.val = (a.val*float64(period-1) + tr) / float64(period)
+	}
+	return a.val
+}
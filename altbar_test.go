@@ -0,0 +1,131 @@
+package banta
+
+import (
+	"math"
+	"testing"
+)
+
+// altEnv set Callback of b to check bar times are increasing and call calc on every bar
+func altEnv(t *testing.T, b *AltBars, calc func(e *BarEnv)) {
+	var lastStop int64
+	b.Callback = func(e *BarEnv) {
+		if e.TimeStart < lastStop || e.TimeStop <= e.TimeStart {
+			t.Fatalf("bar %d: bad time %d - %d, last stop %d", e.BarNum, e.TimeStart, e.TimeStop, lastStop)
+		}
+		lastStop = e.TimeStop
+		if calc != nil {
+			calc(e)
+		}
+	}
+}
+
+func TestRenkoBars(t *testing.T) {
+	env, _ := NewBarEnv("", "", "BTC/USDT", "1m")
+	b := NewRenkoBars(env, 10)
+	var opens, closes []float64
+	altEnv(t, b, func(e *BarEnv) {
+		opens = append(opens, e.Open.Get(0))
+		closes = append(closes, e.Close.Get(0))
+	})
+	// 105不足一个砖块，125生成两个，115不足反转，95反转一个砖块，71再两个
+	prices := []float64{100, 105, 125, 115, 95, 71, 80}
+	for i, p := range prices {
+		b.OnTrade(&Trade{Time: 1000 + int64(i), Price: p, Size: 1})
+	}
+	expOpens := []float64{100, 110, 110, 100, 90}
+	expCloses := []float64{110, 120, 100, 90, 80}
+	if len(opens) != len(expOpens) {
+		t.Fatalf("expect %d bricks, got %v %v", len(expOpens), opens, closes)
+	}
+	for i := range opens {
+		if opens[i] != expOpens[i] || closes[i] != expCloses[i] {
+			t.Fatalf("brick %d: expect %v-%v, got %v-%v", i, expOpens[i], expCloses[i], opens[i], closes[i])
+		}
+	}
+	// 首个砖块包含之前的成交量，同一成交的后续砖块为0
+	if env.Volume.Get(4) != 3 || env.Volume.Get(3) != 0 || env.Volume.Get(0) != 0 || env.Volume.Get(1) != 1 {
+		t.Errorf("bad brick volumes: %v", env.Volume.Data)
+	}
+	if env.TimeStop <= env.Open.Time || env.BarNum != 5 {
+		t.Errorf("bad bar time: %d, %d", env.TimeStart, env.TimeStop)
+	}
+}
+
+func TestRenkoATR(t *testing.T) {
+	env, _ := NewBarEnv("", "", "BTC/USDT", "1d")
+	b := NewRenkoATR(env, 14)
+	cg := &CGraph{}
+	altEnv(t, b, func(e *BarEnv) {
+		SMA(e.Close, 5)
+		RSI(e.Close, 6)
+		cg.AddBar(e)
+		cg.Parse()
+	})
+	for _, k := range waveKlines(300) {
+		b.OnKline(&k, k.Time+86400000)
+	}
+	if env.BarNum < 20 || len(cg.Bars) != env.BarNum {
+		t.Fatalf("expect bricks built, got %d", env.BarNum)
+	}
+	for i := 0; i < env.Close.Len(); i++ {
+		box := math.Abs(env.Close.Get(i) - env.Open.Get(i))
+		if box <= 0 || env.High.Get(i) != max(env.Open.Get(i), env.Close.Get(i)) {
+			t.Fatalf("bad brick %d: %v %v", i, env.Open.Get(i), env.Close.Get(i))
+		}
+	}
+}
+
+func TestThresholdBars(t *testing.T) {
+	trades, _ := minuteTrades(40, nil)
+	var sumVol, sumQuote float64
+	for _, tr := range trades {
+		sumVol += tr.Size
+		sumQuote += tr.Size * tr.Price
+	}
+	cases := []struct {
+		bars  *AltBars
+		field func(e *BarEnv) float64
+	}{
+		{NewRangeBars(nil, 3), func(e *BarEnv) float64 { return e.High.Get(0) - e.Low.Get(0) }},
+		{NewTickBars(nil, 7), func(e *BarEnv) float64 { return e.TradeNum.Get(0) }},
+		{NewVolumeBars(nil, 20), func(e *BarEnv) float64 { return e.Volume.Get(0) }},
+		{NewDollarBars(nil, 2000), func(e *BarEnv) float64 { return e.QuoteVolume.Get(0) }},
+	}
+	for _, c := range cases {
+		env, _ := NewBarEnv("", "", "BTC/USDT", "1m")
+		b := c.bars
+		b.Env = env
+		var vols, quotes float64
+		altEnv(t, b, func(e *BarEnv) {
+			if val := c.field(e); val < b.Size {
+				t.Fatalf("kind %d bar %d: expect full bar, got %v", b.Kind, e.BarNum, val)
+			}
+			vols += e.Volume.Get(0)
+			quotes += e.QuoteVolume.Get(0)
+			EMA(e.Close, 5)
+		})
+		for _, tr := range trades {
+			b.OnTrade(tr)
+		}
+		if env.BarNum < 5 {
+			t.Fatalf("kind %d: expect bars built, got %d", b.Kind, env.BarNum)
+		}
+		if f := b.FormingBar(); f != nil {
+			vols += f.Volume
+			quotes += f.QuoteVolume
+		}
+		if !equalNearly(vols, sumVol) || math.Abs(quotes-sumQuote) > 1e-6 {
+			t.Errorf("kind %d: expect all volume kept, got %v, %v", b.Kind, vols, sumVol)
+		}
+	}
+	// K线输入
+	env, _ := NewBarEnv("", "", "BTC/USDT", "1d")
+	b := NewVolumeBars(env, 2000000)
+	altEnv(t, b, nil)
+	for _, k := range DataKline {
+		b.OnKline(&k, k.Time+86400000)
+	}
+	if env.BarNum < 5 || env.Volume.Get(0) < 2000000 {
+		t.Errorf("expect volume bars from klines, got %d", env.BarNum)
+	}
+}
@@ -0,0 +1,127 @@
+package banta
+
+import (
+	"math"
+	"slices"
+)
+
+// auxInput pending values of an auxiliary series, aligned to bars on OnBar
+type auxInput struct {
+	ser  *Series
+	pend []auxVal // 按时间升序，尚未对齐到bar的值
+	last float64  // 最近对齐的值，用于as-of填充
+}
+
+type auxVal struct {
+	time int64
+	val  float64
+}
+
+/*
+Aux return the named auxiliary input series (such as funding rate or open interest), create it if not exist.
+It's fed by FeedAux and can be used as an ordinary Series in all indicators. Like ohlcv it's never evicted,
+and trimmed by MaxCache. Values before creation are NaN.
+
+返回命名的辅助输入序列（如资金费率、持仓量），不存在时创建。通过FeedAux输入数据，可作为普通序列用于所有指标。
+和ohlcv一样不会被移除，按MaxCache裁剪。创建之前的值为NaN
+*/
+func (e *BarEnv) Aux(name string) *Series {
+	e.lockAux.Lock()
+	defer e.lockAux.Unlock()
+	if in, ok := e.aux[name]; ok {
+		return in.ser
+	}
+	in := &auxInput{ser: e.newAux(name), last: math.NaN()}
+	if e.aux == nil {
+		e.aux = make(map[string]*auxInput)
+	}
+	e.aux[name] = in
+	return in.ser
+}
+
+func (e *BarEnv) newAux(name string) *Series {
+	var data []float64
+	if e.Close != nil {
+		data = make([]float64, e.Close.Len())
+		for i := range data {
+			data[i] = math.NaN()
+		}
+	}
+	s := e.NewSeries(data)
+	s.auxName = name
+	return s
+}
+
+/*
+FeedAux add a value observed at timeMS to the named auxiliary series, create it if not exist.
+
+Values are aligned to bars by as-of join: a bar uses the latest value whose time is before its end,
+bars without new values keep the previous one. Values for the current finished bar which arrive late
+are used by the next bar, or by OnBarUpdate when Intrabar is enabled.
+
+向命名的辅助序列添加timeMS时刻的值，不存在时创建。按as-of方式对齐到bar：每个bar使用结束时间之前的最新值，
+没有新值的bar沿用之前的值。当前bar完成后迟到的值用于下一个bar，开启Intrabar时也可通过OnBarUpdate更新当前bar
+*/
+func (e *BarEnv) FeedAux(name string, timeMS int64, val float64) {
+	e.Aux(name)
+	e.lockAux.Lock()
+	in := e.aux[name]
+	item := auxVal{time: timeMS, val: val}
+	if num := len(in.pend); num == 0 || in.pend[num-1].time <= timeMS {
+		in.pend = append(in.pend, item)
+	} else {
+		idx, _ := slices.BinarySearchFunc(in.pend, timeMS, func(v auxVal, t int64) int {
+			return int(max(min(v.time-t, 1), -1))
+		})
+		in.pend = slices.Insert(in.pend, idx, item)
+	}
+	e.lockAux.Unlock()
+}
+
+// AuxNames return names of all auxiliary series
+func (e *BarEnv) AuxNames() []string {
+	e.lockAux.Lock()
+	defer e.lockAux.Unlock()
+	res := make([]string, 0, len(e.aux))
+	for name := range e.aux {
+		res = append(res, name)
+	}
+	slices.Sort(res)
+	return res
+}
+
+// alignAux append values of auxiliary series for the new bar, or update the latest value if update is true
+func (e *BarEnv) alignAux(update bool) {
+	e.lockAux.Lock()
+	defer e.lockAux.Unlock()
+	for _, in := range e.aux {
+		num := 0
+		for num < len(in.pend) && in.pend[num].time < e.TimeStop {
+			num++
+		}
+		if num > 0 {
+			in.last = in.pend[num-1].val
+			in.pend = in.pend[num:]
+		}
+		s := in.ser
+		if update {
+			if num > 0 {
+				s.setLast(in.last)
+			}
+			continue
+		}
+		s.Time = e.TimeStart
+		s.Data = append(s.Data, in.last)
+	}
+}
+
+// resetAux clear values and pending inputs of auxiliary series, names are kept
+func (e *BarEnv) resetAux() {
+	e.lockAux.Lock()
+	defer e.lockAux.Unlock()
+	for name, in := range e.aux {
+		// 旧序列不再作为根序列，可被Evict移除
+		in.ser.auxName = ""
+		e.aux[name] = &auxInput{ser: e.newAux(name), last: math.NaN()}
+	}
+}
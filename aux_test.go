@@ -0,0 +1,110 @@
+package banta
+
+import (
+	"math"
+	"testing"
+
+	"github.com/banbox/banta/tav"
+)
+
+func TestAux(t *testing.T) {
+	env, _ := NewBarEnv("binance", "future", "BTC/USDT", "1d")
+	env.MaxCache = 20
+	const day = int64(86400000)
+	start := DataKline[0].Time
+	// 资金费率每8小时一次，从第3个bar开始
+	var feeds []float64
+	for i := 2; i < len(DataKline); i++ {
+		for h := int64(0); h < 3; h++ {
+			val := float64(i) + float64(h)/10
+			env.FeedAux("funding", start+int64(i)*day+h*8*3600000, val)
+		}
+		feeds = append(feeds, float64(i)+0.2)
+	}
+	// 乱序添加
+	env.FeedAux("oi", start+day*5, 5)
+	env.FeedAux("oi", start+day*3+1, 3)
+	var expects []float64
+	for i, k := range DataKline {
+		if err := env.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info); err != nil {
+			t.Fatal(err)
+		}
+		fund := env.Aux("funding")
+		exp := math.NaN()
+		if i >= 2 {
+			exp = feeds[i-2]
+		}
+		expects = append(expects, exp)
+		if val := fund.Get(0); !equalNearly(val, exp) {
+			t.Fatalf("bar %d: expect funding %v, got %v", i, exp, val)
+		}
+		oi := env.Aux("oi").Get(0)
+		expOI := math.NaN()
+		if i >= 5 {
+			expOI = 5
+		} else if i >= 3 {
+			expOI = 3
+		}
+		if !equalNearly(oi, expOI) {
+			t.Fatalf("bar %d: expect oi %v, got %v", i, expOI, oi)
+		}
+		if fund.Len() != env.Close.Len() {
+			t.Fatalf("bar %d: aux len %d, close len %d", i, fund.Len(), env.Close.Len())
+		}
+		smas := tav.SMA(expects, 3)
+		if val := SMA(fund, 3).Get(0); !equalNearly(val, smas[len(smas)-1]) {
+			t.Fatalf("bar %d: expect sma %v, got %v", i, smas[len(smas)-1], val)
+		}
+	}
+	if n := env.Aux("funding").Len(); n > int(float64(env.MaxCache)*1.5) {
+		t.Errorf("expect aux trimmed by MaxCache, got %d", n)
+	}
+	env.Evict(1)
+	if env.Items[env.Aux("funding").ID] == nil {
+		t.Error("aux series should not be evicted")
+	}
+	// 创建于中途的序列之前为NaN，迟到的值用于下一个bar
+	late := env.Aux("late")
+	if late.Len() != env.Close.Len() || !math.IsNaN(late.Get(0)) {
+		t.Errorf("expect new aux filled with NaN, got %d, %v", late.Len(), late.Get(0))
+	}
+	env.FeedAux("late", env.TimeStart+1, 7)
+	env.OnBar(env.TimeStop, 1, 1, 1, 1, 1, 1)
+	if val := late.Get(0); val != 7 {
+		t.Errorf("expect late value used by next bar, got %v", val)
+	}
+}
+
+func TestAuxBarUpdate(t *testing.T) {
+	env, _ := NewBarEnv("binance", "future", "BTC/USDT", "1d")
+	env.Intrabar = true
+	k := DataKline[0]
+	if err := env.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info); err != nil {
+		t.Fatal(err)
+	}
+	oi := env.Aux("oi")
+	env.FeedAux("oi", k.Time+10, 100)
+	err := env.OnBarUpdate(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val := oi.Get(0); val != 100 {
+		t.Errorf("expect updated aux value 100, got %v", val)
+	}
+	if val := SMA(oi, 1).Get(0); val != 100 {
+		t.Errorf("expect sma 100, got %v", val)
+	}
+	env.FeedAux("oi", k.Time+20, 120)
+	_ = env.OnBarUpdate(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+	if val := SMA(oi, 1).Get(0); val != 120 || oi.Len() != 1 {
+		t.Errorf("expect sma 120 after update, got %v, len %d", val, oi.Len())
+	}
+	clone := env.Clone()
+	if s := clone.Aux("oi"); s.Get(0) != 120 || s == oi {
+		t.Errorf("expect aux copied to clone, got %v", s.Get(0))
+	}
+	env.Reset()
+	if names := env.AuxNames(); len(names) != 1 || env.Aux("oi").Len() != 0 {
+		t.Errorf("expect aux kept and cleared after reset, got %v", names)
+	}
+}
@@ -0,0 +1,380 @@
+package banta
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/banbox/banta/tav"
+)
+
+// BulkInd an indicator to compute in LoadKlines
+type BulkInd struct {
+	Name   string    // 指标名，见Indicators
+	Inputs []string  // 输入序列名，为空时使用指标默认输入，只支持ohlcv等BarEnv的序列
+	Params []float64 // 参数，末尾缺失的使用默认值
+}
+
+// indSeed set states of an indicator and its dependencies after bulk loading.
+// ins are seeded input Series, vecs are all input values, vals are vectorized results
+type indSeed func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64)
+
+// indSeeds indicators whose states can be seeded from vectorized results, others are computed by streaming
+var indSeeds = map[string]indSeed{
+	"Sum": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		e.seedSum(ins[0], vecs[0], int(p[0]))
+	},
+	"SMA": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		e.seedSMA(ins[0], vecs[0], int(p[0]), vals[0])
+	},
+	"EMA": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		e.seedEWMA(ins[0], vecs[0], Key("_ema", int(p[0]), 0), int(p[0]), 0, vals[0])
+	},
+	"EMABy": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		key := Key("_ema", int(p[0]), int(p[1]))
+		e.seedEWMA(ins[0], vecs[0], key, int(p[0]), int(p[1]), vals[0])
+	},
+	"RMA": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		key := Key("_rma", int(p[0]), 0, math.NaN())
+		e.seedEWMA(ins[0], vecs[0], key, int(p[0]), 0, vals[0])
+	},
+	"RMABy": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		key := Key("_rma", int(p[0]), int(p[1]), p[2])
+		e.seedEWMA(ins[0], vecs[0], key, int(p[0]), int(p[1]), vals[0])
+	},
+	"WMA": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		e.seedWMA(ins[0], vecs[0], int(p[0]), vals[0])
+	},
+	"VWMA": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		period := int(p[0])
+		res := ins[0].ToKey(Key("_vwma", ins[1], period))
+		e.seedData(res, vals[0])
+		more := &moreVWMA{}
+		for i, price := range vecs[0] {
+			vol := vecs[1][i]
+			if cost := price * vol; !math.IsNaN(cost) {
+				more.sumCost += cost
+				more.sumWei += vol
+				more.volumes = append(more.volumes, vol)
+				more.costs = append(more.costs, cost)
+				if len(more.volumes) > period {
+					more.sumCost -= more.costs[0]
+					more.sumWei -= more.volumes[0]
+					more.costs = more.costs[1:]
+					more.volumes = more.volumes[1:]
+				}
+			}
+		}
+		res.More, res.DupMore = more, dupMoreState
+	},
+	"TR": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		e.seedTR(ins, vecs, vals[0])
+	},
+	"ATR": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		trVec := tav.TR(vecs[0], vecs[1], vecs[2])
+		tr := e.seedTR(ins, vecs, trVec)
+		key := Key("_rma", int(p[0]), 0, math.NaN())
+		e.seedEWMA(tr, trVec, key, int(p[0]), 0, vals[0])
+	},
+	"Highest": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		e.seedWindow(ins[0].ToKey(Key("_hh", int(p[0]))), vecs[0], int(p[0])-1, vals[0])
+	},
+	"Lowest": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		e.seedWindow(ins[0].ToKey(Key("_ll", int(p[0]))), vecs[0], int(p[0])-1, vals[0])
+	},
+	"ROC": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		e.seedWindow(ins[0].ToKey(Key("_roc", int(p[0]))), vecs[0], int(p[0])+1, vals[0])
+	},
+	"RSI": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		e.seedRSI(ins[0], vecs[0], int(p[0]), 0, vals[0])
+	},
+	"RSI50": func(e *BarEnv, ins []*Series, vecs [][]float64, p []float64, vals [][]float64) {
+		e.seedRSI(ins[0], vecs[0], int(p[0]), 50, vals[0])
+	},
+}
+
+/*
+LoadKlines bulk load history bars into an empty BarEnv and compute inds on them, return Series of inds on the
+last bar. The result is the same as calling OnKline and inds for every bar, and later bars can be added as usual.
+
+OHLCV and extended Series are filled at once. Indicators such as SMA, EMA, RMA, WMA, VWMA, TR, ATR, Highest,
+Lowest, ROC, RSI are computed by tav and their states are seeded. If any of inds can't be seeded, or the env has
+subscriptions, listeners, auxiliary series, or bars have gaps, all bars are streamed instead.
+
+批量加载历史K线到空的BarEnv并计算inds，返回最后一个bar上各指标的序列。结果和逐个bar调用OnKline及指标相同，之后可正常添加K线。
+OHLCV和扩展序列一次性填充；SMA、EMA、RMA、WMA、VWMA、TR、ATR、Highest、Lowest、ROC、RSI等指标通过tav计算并设置状态。
+有指标不支持设置状态，或env有订阅、监听、辅助序列，或K线有缺失时，逐个bar计算
+*/
+func (e *BarEnv) LoadKlines(klines []Kline, inds ...*BulkInd) ([][]*Series, error) {
+	if e.Close != nil {
+		return nil, fmt.Errorf("%s/%s LoadKlines requires an empty BarEnv", e.Symbol, e.TimeFrame)
+	}
+	infos := make([]*IndInfo, len(inds))
+	items := make([]*BulkInd, len(inds))
+	params := make([][]float64, len(inds))
+	canSeed := len(klines) > 1
+	for i, item := range inds {
+		info := GetIndicator(item.Name)
+		if info == nil {
+			return nil, fmt.Errorf("%w: unknown indicator %s", ErrInvalidIndArgs, item.Name)
+		}
+		p, err := info.CheckArgs(item.Params)
+		if err != nil {
+			return nil, err
+		}
+		inputs := item.Inputs
+		if len(inputs) == 0 {
+			inputs = info.Inputs
+		}
+		if len(inputs) != len(info.Inputs) {
+			return nil, fmt.Errorf("%w: %s expects %d inputs, got %d", ErrInvalidIndArgs, info.Name,
+				len(info.Inputs), len(inputs))
+		}
+		for _, name := range inputs {
+			if !exprVars[name] {
+				return nil, fmt.Errorf("%w: %s input %s is not a BarEnv series", ErrInvalidIndArgs, info.Name, name)
+			}
+		}
+		if _, ok := indSeeds[info.Name]; !ok {
+			canSeed = false
+		}
+		infos[i], params[i] = info, p
+		items[i] = &BulkInd{Name: info.Name, Inputs: inputs, Params: p}
+	}
+	if canSeed && e.canBulkLoad(klines) {
+		if err := e.seedKlines(klines[:len(klines)-1], infos, items); err != nil {
+			return nil, err
+		}
+		klines = klines[len(klines)-1:]
+	}
+	var res [][]*Series
+	for i := range klines {
+		if err := e.OnKline(&klines[i]); err != nil {
+			return nil, err
+		}
+		res = res[:0]
+		for j, info := range infos {
+			ins := make([]*Series, len(items[j].Inputs))
+			for k, name := range items[j].Inputs {
+				ins[k] = e.varSeries(name)
+			}
+			outs, err := info.Call(e, ins, params[j]...)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, outs)
+		}
+	}
+	return res, nil
+}
+
+// canBulkLoad check whether states of env can be seeded without streaming klines
+func (e *BarEnv) canBulkLoad(klines []Kline) bool {
+	e.lockSubs.Lock()
+	subNum := len(e.subs)
+	e.lockSubs.Unlock()
+	e.lockListen.Lock()
+	listenNum := len(e.listeners)
+	e.lockListen.Unlock()
+	e.lockAux.Lock()
+	auxNum := len(e.aux)
+	e.lockAux.Unlock()
+	if subNum > 0 || listenNum > 0 || auxNum > 0 || e.EvictIdle > 0 {
+		return false
+	}
+	for i := 1; i < len(klines); i++ {
+		end := e.barEnd(klines[i-1].Time)
+		if klines[i].Time < end || klines[i].Time > end && e.GapPolicy != GapIgnore {
+			return false
+		}
+	}
+	return true
+}
+
+// seedKlines fill ohlcv and extended Series with klines, and seed states of inds
+func (e *BarEnv) seedKlines(klines []Kline, infos []*IndInfo, inds []*BulkInd) error {
+	num := len(klines)
+	if e.MaxCache == 0 {
+		e.MaxCache = 1000
+	}
+	// 逐个添加时TrimOverflow后保留的长度
+	keep, trimLen := 0, int(float64(e.MaxCache)*1.5)
+	for i := 0; i < num; i++ {
+		keep += 1
+		if i > 0 && trimLen > 0 && keep >= trimLen {
+			keep = e.MaxCache
+		}
+	}
+	vecs := make(map[string][]float64)
+	names := []string{"open", "high", "low", "close", "volume", "info", "quote", "trades", "buy"}
+	for _, name := range names {
+		vecs[name] = make([]float64, num)
+	}
+	for i, k := range klines {
+		vals := []float64{k.Open, k.High, k.Low, k.Close, k.Volume, k.Info, k.QuoteVolume, k.TradeNum, k.BuyVolume}
+		for j, name := range names {
+			vecs[name][i] = vals[j]
+		}
+	}
+	last := klines[num-1].Time
+	e.TimeStart = last
+	e.TimeStop = e.barEnd(last)
+	e.BarNum = num
+	roots := []**Series{&e.Open, &e.High, &e.Low, &e.Close, &e.Volume, &e.Info,
+		&e.QuoteVolume, &e.TradeNum, &e.BuyVolume}
+	for i, name := range names {
+		*roots[i] = e.NewSeries(slices.Clone(vecs[name][num-keep:]))
+	}
+	for i, info := range infos {
+		ins := make([]*Series, len(inds[i].Inputs))
+		insVec := make([][]float64, len(inds[i].Inputs))
+		for j, name := range inds[i].Inputs {
+			ins[j] = e.varSeries(name)
+			insVec[j] = vecs[name]
+		}
+		vals, err := info.CallVec(insVec, inds[i].Params...)
+		if err != nil {
+			return err
+		}
+		indSeeds[info.Name](e, ins, insVec, inds[i].Params, vals)
+	}
+	return nil
+}
+
+// seedData set Data of s to the latest values of vals, aligned with ohlcv
+func (e *BarEnv) seedData(s *Series, vals []float64) {
+	keep := e.Close.Len()
+	if e.BarNum > keep {
+		// 逐个计算时指标在TrimOverflow之后才添加，比ohlcv多保留一个
+		keep += 1
+	}
+	keep = min(keep, len(vals))
+	s.Data = slices.Clone(vals[len(vals)-keep:])
+	s.Time = e.TimeStart
+}
+
+func (e *BarEnv) seedSum(obj *Series, vec []float64, period int) *Series {
+	res := obj.ToKey(Key("_sum", period))
+	e.seedData(res, tav.Sum(vec, period))
+	sta := &sumState{}
+	for _, v := range vec {
+		if math.IsNaN(v) {
+			continue
+		}
+		sta.sumVal += v
+		sta.arr = append(sta.arr, v)
+		if len(sta.arr) > period {
+			sta.sumVal -= sta.arr[0]
+			sta.arr = sta.arr[1:]
+		}
+	}
+	res.More, res.DupMore = sta, dupMoreState
+	return res
+}
+
+func (e *BarEnv) seedSMA(obj *Series, vec []float64, period int, vals []float64) *Series {
+	e.seedSum(obj, vec, period)
+	res := obj.ToKey(Key("_sma", period))
+	e.seedData(res, vals)
+	return res
+}
+
+// seedEWMA seed EMA or RMA, the state is the latest valid result
+func (e *BarEnv) seedEWMA(obj *Series, vec []float64, key ParamKey, period, initType int, vals []float64) *Series {
+	if initType == 0 {
+		// 未初始化时使用SMA
+		e.seedSMA(obj, vec, period, tav.SMA(vec, period))
+	}
+	res := obj.ToKey(key)
+	e.seedData(res, vals)
+	prev := math.NaN()
+	for i := len(vals) - 1; i >= 0; i-- {
+		if !math.IsNaN(vals[i]) {
+			prev = vals[i]
+			break
+		}
+	}
+	res.More = prev
+	return res
+}
+
+func (e *BarEnv) seedWMA(obj *Series, vec []float64, period int, vals []float64) *Series {
+	res := obj.ToKey(Key("_wma", period))
+	e.seedData(res, vals)
+	more := &wmaSta{}
+	for _, val := range vec {
+		if math.IsNaN(val) {
+			continue
+		}
+		more.arr = append(more.arr, val)
+		if len(more.arr) > period {
+			more.allSum -= more.weiSum
+			more.weiSum -= more.arr[0]
+			more.arr = more.arr[1:]
+		}
+		more.weiSum += val
+		more.allSum += val * float64(len(more.arr))
+	}
+	res.More, res.DupMore = more, dupMoreState
+	return res
+}
+
+func (e *BarEnv) seedTR(ins []*Series, vecs [][]float64, vals []float64) *Series {
+	res := ins[0].ToKey(Key("_tr", ins[1], ins[2]))
+	e.seedData(res, vals)
+	closes := vecs[2]
+	for i := len(closes) - 1; i >= 0; i-- {
+		if !math.IsNaN(closes[i]) {
+			res.More = closes[i]
+			break
+		}
+	}
+	return res
+}
+
+// seedWindow seed indicators whose state is the latest size valid inputs
+func (e *BarEnv) seedWindow(res *Series, vec []float64, size int, vals []float64) *Series {
+	e.seedData(res, vals)
+	valid := make([]float64, 0, size)
+	for i := len(vec) - 1; i >= 0 && len(valid) < size; i-- {
+		if !math.IsNaN(vec[i]) {
+			valid = append(valid, vec[i])
+		}
+	}
+	slices.Reverse(valid)
+	res.More, res.DupMore = valid, dupFloatArr
+	return res
+}
+
+func (e *BarEnv) seedRSI(obj *Series, vec []float64, period int, subVal float64, vals []float64) *Series {
+	res := obj.ToKey(Key("_rsi", period, subVal))
+	e.seedData(res, vals)
+	// 状态: [0:prevVal, 1:avgGain, 2:avgLoss, 3:validCount]
+	more := []float64{math.NaN(), 0, 0, 0}
+	for _, curVal := range vec {
+		if math.IsNaN(curVal) {
+			continue
+		}
+		prevVal := more[0]
+		more[0] = curVal
+		if math.IsNaN(prevVal) {
+			continue
+		}
+		more[3] += 1
+		var gainDelta, lossDelta float64
+		if delta := curVal - prevVal; delta >= 0 {
+			gainDelta = delta
+		} else {
+			lossDelta = -delta
+		}
+		if more[3] > float64(period) {
+			more[1] = (more[1]*float64(period-1) + gainDelta) / float64(period)
+			more[2] = (more[2]*float64(period-1) + lossDelta) / float64(period)
+		} else {
+			more[1] += gainDelta / float64(period)
+			more[2] += lossDelta / float64(period)
+		}
+	}
+	res.More, res.DupMore = more, dupFloatArr
+	return res
+}
@@ -0,0 +1,119 @@
+package banta
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLoadKlines(t *testing.T) {
+	klines := waveKlines(400)
+	klines[100].Close = math.NaN()
+	inds := []*BulkInd{
+		{Name: "Sum", Params: []float64{10}},
+		{Name: "SMA"},
+		{Name: "SMA", Inputs: []string{"volume"}, Params: []float64{5}},
+		{Name: "EMA", Params: []float64{12}},
+		{Name: "EMABy", Params: []float64{10, 1}},
+		{Name: "RMA", Params: []float64{14}},
+		{Name: "RMABy", Params: []float64{7, 0, 100}},
+		{Name: "WMA"},
+		{Name: "VWMA"},
+		{Name: "TR"},
+		{Name: "ATR"},
+		{Name: "Highest"},
+		{Name: "Lowest", Inputs: []string{"low"}, Params: []float64{7}},
+		{Name: "ROC"},
+		{Name: "RSI"},
+		{Name: "RSI50", Params: []float64{6}},
+		{Name: "QVWAP", Params: []float64{3}},
+	}
+	const split, maxCache = 300, 80
+	for _, seeded := range []bool{true, false} {
+		list := inds
+		if seeded {
+			// QVWAP不支持设置状态，逐个bar计算
+			list = inds[:len(inds)-1]
+		}
+		stream, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+		bulk, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+		for _, env := range []*BarEnv{stream, bulk} {
+			env.MaxCache = maxCache
+			env.Intrabar = true
+		}
+		res, err := bulk.LoadKlines(klines[:split], list...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != len(list) {
+			t.Fatalf("expect %d results, got %d", len(list), len(res))
+		}
+		var expects [][]*Series
+		for i := range klines {
+			k := &klines[i]
+			if i >= split {
+				if err = bulk.OnKline(k); err != nil {
+					t.Fatal(err)
+				}
+				res = bulkCall(t, bulk, list)
+			}
+			if err = stream.OnKline(k); err != nil {
+				t.Fatal(err)
+			}
+			expects = bulkCall(t, stream, list)
+			if i < split-1 {
+				continue
+			}
+			if bulk.BarNum != stream.BarNum || bulk.Close.Len() != stream.Close.Len() {
+				t.Fatalf("bar %d: expect %d bars, got %d", i, stream.Close.Len(), bulk.Close.Len())
+			}
+			for j, outs := range expects {
+				for n, exp := range outs {
+					got := res[j][n]
+					if got.Len() != exp.Len() {
+						t.Fatalf("%s bar %d: expect len %d, got %d", list[j].Name, i, exp.Len(), got.Len())
+					}
+					for m := 0; m < exp.Len(); m++ {
+						if !equalNearly(got.Get(m), exp.Get(m)) {
+							t.Fatalf("%s bar %d[%d]: expect %v, got %v", list[j].Name, i, m, exp.Get(m), got.Get(m))
+						}
+					}
+				}
+			}
+		}
+		// 之后的实时更新和逐个计算一致
+		last := klines[len(klines)-1]
+		last.Close += 3
+		for _, env := range []*BarEnv{stream, bulk} {
+			if err = env.OnKlineUpdate(&last); err != nil {
+				t.Fatal(err)
+			}
+		}
+		res, expects = bulkCall(t, bulk, list), bulkCall(t, stream, list)
+		for j, outs := range expects {
+			if !equalNearly(res[j][0].Get(0), outs[0].Get(0)) {
+				t.Errorf("%s update: expect %v, got %v", list[j].Name, outs[0].Get(0), res[j][0].Get(0))
+			}
+		}
+	}
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	if _, err := env.LoadKlines(klines, &BulkInd{Name: "FOO"}); err == nil {
+		t.Error("expect error for unknown indicator")
+	}
+}
+
+func bulkCall(t *testing.T, e *BarEnv, inds []*BulkInd) [][]*Series {
+	res := make([][]*Series, 0, len(inds))
+	for _, item := range inds {
+		ind := GetIndicator(item.Name)
+		var ins []*Series
+		for _, name := range item.Inputs {
+			ins = append(ins, e.varSeries(name))
+		}
+		outs, err := ind.Call(e, ins, item.Params...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, outs)
+	}
+	return res
+}
@@ -5,38 +5,175 @@ import (
 	"maps"
 	"math"
 	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 func NewBarEnv(exgName, market, symbol, timeframe string) (*BarEnv, error) {
-	tfSecs, err := ParseTimeFrame(timeframe)
+	frame, err := ParseTFrame(timeframe)
 	if err != nil {
 		return nil, err
 	}
+	return NewBarEnvIn(exgName, market, symbol, frame), nil
+}
+
+/*
+NewBarEnvIn create BarEnv with a calendar and timezone aware timeframe
+
+使用支持日历和时区的周期创建BarEnv
+*/
+func NewBarEnvIn(exgName, market, symbol string, frame *TFrame) *BarEnv {
 	return &BarEnv{
 		Exchange:   exgName,
 		MarketType: market,
 		Symbol:     symbol,
-		TimeFrame:  timeframe,
-		TFMSecs:    int64(tfSecs * 1000),
+		TimeFrame:  frame.Name,
+		TFMSecs:    frame.MSecs,
+		Frame:      frame,
 		MaxCache:   1500,
 		Data:       sync.Map{},
 		Items:      make(map[int]*Series),
-	}, nil
+	}
 }
 
+/*
+OnBar add a new finished bar. Missing bars between the last bar and barMs are handled by GapPolicy.
+Subscriptions and OnGapBar are computed on each inserted bar, other derived Series computed on the last bar
+get NaN, so they stay aligned with OHLCV.
+
+添加一个已完成的K线，和上一个K线之间缺失的K线按GapPolicy处理。
+插入的每个K线上计算订阅和OnGapBar，其他在上一个bar计算过的派生序列补充NaN，保持和OHLCV对齐
+*/
 func (e *BarEnv) OnBar(barMs int64, open, high, low, close, volume, info float64) error {
+	return e.onBar(barMs, open, high, low, close, volume, info, nil)
+}
+
+// onBar add a new finished bar, ext carries extended fields if not nil
+func (e *BarEnv) onBar(barMs int64, open, high, low, close, volume, info float64, ext *Kline) error {
 	if e.TimeStop > barMs {
 		return fmt.Errorf("%s/%s old Bar Receive: %d, Current: %d", e.Symbol, e.TimeFrame, barMs, e.TimeStop)
 	}
-	e.OnBar2(barMs, barMs+e.TFMSecs, open, high, low, close, volume, info)
+	if err := e.fillGap(barMs); err != nil {
+		return err
+	}
+	e.extBar = ext
+	e.OnBar2(barMs, e.barEnd(barMs), open, high, low, close, volume, info)
 	return nil
 }
 
+// barEnd return the end time of bar which starts at barMs
+func (e *BarEnv) barEnd(barMs int64) int64 {
+	if e.Frame == nil {
+		return barMs + e.TFMSecs
+	}
+	return e.Frame.BarEnd(barMs)
+}
+
+// barStart return the start time of bar which contains ms
+func (e *BarEnv) barStart(ms int64) int64 {
+	if e.Frame == nil {
+		return ms - ms%e.TFMSecs
+	}
+	return e.Frame.BarStart(ms)
+}
+
+// prevStop return the end time of bar before the bar which ends at stop
+func (e *BarEnv) prevStop(stop int64) int64 {
+	if e.Frame == nil || !e.Frame.IsCalendar() {
+		return stop - e.TFMSecs
+	}
+	return e.Frame.BarStart(stop - 1)
+}
+
+// fillGap check missing bars before barMs, and insert them according to GapPolicy
+func (e *BarEnv) fillGap(barMs int64) error {
+	if e.GapPolicy == GapIgnore || e.Close == nil || e.TFMSecs <= 0 {
+		return nil
+	}
+	var missNum int
+	if e.Frame == nil || !e.Frame.IsCalendar() {
+		missNum = int((barMs - e.TimeStop) / e.TFMSecs)
+	} else {
+		for stop := e.TimeStop; e.barEnd(stop) <= barMs; stop = e.barEnd(stop) {
+			missNum += 1
+		}
+	}
+	if missNum <= 0 {
+		return nil
+	}
+	if e.GapPolicy == GapError {
+		return fmt.Errorf("%w %s/%s %d: %d bars since %d", ErrBarGap, e.Symbol, e.TimeFrame, barMs, missNum, e.TimeStop)
+	}
+	price, info := e.Close.Get(0), e.Info.Get(0)
+	volume := float64(0)
+	if e.GapPolicy == GapNaN {
+		price, volume, info = math.NaN(), math.NaN(), math.NaN()
+	}
+	// 最近一个bar上计算过的派生序列，插入的K线上未计算时补充NaN，保持和ohlcv对齐
+	derived := e.liveDerived()
+	for i := 0; i < missNum; i++ {
+		start := e.TimeStop
+		if e.QuoteVolume != nil && e.GapPolicy != GapNaN {
+			// 扩展字段和成交量一样填充0
+			e.extBar = &Kline{}
+		}
+		e.OnBar2(start, e.barEnd(start), price, price, price, price, volume, info)
+		if e.OnGapBar != nil {
+			e.OnGapBar(e)
+		}
+		for _, s := range derived {
+			s.LockData.Lock()
+			if !s.Cached() {
+				s.Append(math.NaN())
+			}
+			s.LockData.Unlock()
+		}
+	}
+	e.GapNum += missNum
+	return nil
+}
+
+// liveDerived return derived Series which are computed on the latest bar, Back views are excluded
+func (e *BarEnv) liveDerived() []*Series {
+	e.LockItems.RLock()
+	items := make([]*Series, 0, len(e.Items))
+	for _, s := range e.Items {
+		items = append(items, s)
+	}
+	// ToKey创建序列时持有子锁再获取LockItems，这里需先释放LockItems
+	e.LockItems.RUnlock()
+	// Back的结果引用父序列的数据，每个bar重新切片，不能追加
+	views := make(map[*Series]bool)
+	for _, s := range items {
+		s.LockSub.Lock()
+		sub, lock := s.Subs["_back"], s.LockSubMap["_back"]
+		s.LockSub.Unlock()
+		if lock == nil {
+			continue
+		}
+		lock.Lock()
+		for _, v := range sub {
+			views[v] = true
+		}
+		lock.Unlock()
+	}
+	var res []*Series
+	for _, s := range items {
+		if !e.isRoot(s) && !views[s] && s.Cached() {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
 func (e *BarEnv) OnBar2(barMS, endMS int64, open, high, low, close, volume, info float64) {
 	e.TimeStart = barMS
 	e.TimeStop = endMS
 	e.BarNum += 1
+	e.alignAux(false)
+	e.appendExt()
 	if e.Open == nil {
 		e.Open = e.NewSeries([]float64{open})
 		e.High = e.NewSeries([]float64{high})
@@ -62,6 +199,78 @@ func (e *BarEnv) OnBar2(barMS, endMS int64, open, high, low, close, volume, info
 		e.Info.Time = barMS
 		e.Info.Data = append(e.Info.Data, info)
 		e.TrimOverflow()
+		if e.EvictIdle > 0 && e.BarNum%e.EvictIdle == 0 {
+			e.Evict(e.EvictIdle)
+		}
+	}
+	e.fireRootHooks()
+	if e.Intrabar {
+		e.snapshot()
+	}
+	e.calcSubs()
+	e.notifyBar()
+}
+
+/*
+OnBarUpdate update the latest unfinished bar with real-time values.
+
+A newer barMs starts a new bar (same as OnBar). For the current bar, OHLCV is replaced and all derived
+Series are rolled back to the state before this bar, call indicators again to get real-time values.
+
+更新当前未完成的K线。barMs更新时开始新bar；否则替换最新OHLCV，并将所有派生序列回滚到此bar之前的状态，
+再次调用指标函数即可得到实时值。
+*/
+func (e *BarEnv) OnBarUpdate(barMs int64, open, high, low, close, volume, info float64) error {
+	if e.Open == nil || barMs > e.TimeStart {
+		e.Intrabar = true
+		return e.OnBar(barMs, open, high, low, close, volume, info)
+	}
+	if barMs < e.TimeStart {
+		return fmt.Errorf("%s/%s old Bar Update: %d, Current: %d", e.Symbol, e.TimeFrame, barMs, e.TimeStart)
+	}
+	if e.snapBar != barMs {
+		return fmt.Errorf("%s/%s no snapshot for bar %d, set Intrabar before OnBar", e.Symbol, e.TimeFrame, barMs)
+	}
+	e.Open.setLast(open)
+	e.High.setLast(high)
+	e.Low.setLast(low)
+	e.Close.setLast(close)
+	e.Volume.setLast(volume)
+	e.Info.setLast(info)
+	e.alignAux(true)
+	e.updateExt()
+	e.fireRootHooks()
+	e.rollback()
+	e.calcSubs()
+	return e.notifyUpdate()
+}
+
+func (e *BarEnv) roots() []*Series {
+	return []*Series{e.Open, e.High, e.Low, e.Close, e.Volume, e.Info}
+}
+
+func (e *BarEnv) isRoot(s *Series) bool {
+	return s == e.Open || s == e.High || s == e.Low || s == e.Close || s == e.Volume || s == e.Info ||
+		s == e.QuoteVolume || s == e.TradeNum || s == e.BuyVolume || s.auxName != ""
+}
+
+// snapshot save states of all Series before computing current bar
+func (e *BarEnv) snapshot() {
+	e.snapBar = e.TimeStart
+	e.LockItems.RLock()
+	defer e.LockItems.RUnlock()
+	for _, s := range e.Items {
+		s.snapshot()
+	}
+}
+
+// rollback restore all derived Series to the snapshot, so that current bar can be computed again
+func (e *BarEnv) rollback() {
+	e.LockItems.RLock()
+	defer e.LockItems.RUnlock()
+	for _, s := range e.Items {
+		// ohlcv only restore cross logs, data is replaced by OnBarUpdate
+		s.rollback(!e.isRoot(s))
 	}
 }
 
@@ -69,30 +278,63 @@ func (e *BarEnv) Reset() {
 	e.TimeStart = 0
 	e.TimeStop = 0
 	e.BarNum = 0
+	e.GapNum = 0
 	e.Open = nil
 	e.High = nil
 	e.Low = nil
 	e.Close = nil
 	e.Volume = nil
 	e.Info = nil
+	e.QuoteVolume = nil
+	e.TradeNum = nil
+	e.BuyVolume = nil
+	e.lockSubs.Lock()
+	for _, s := range e.subs {
+		s.res = nil
+	}
+	e.lockSubs.Unlock()
+	e.resetAux()
+	e.lockListen.Lock()
+	listeners := e.listeners
+	e.lockListen.Unlock()
+	for _, l := range listeners {
+		l.reset()
+	}
 }
 
+/*
+TrimOverflow keep the latest MaxCache values for every Series in env (including Cols) and cross histories,
+when the length of Close reaches 1.5 times of MaxCache.
+
+Close长度达到MaxCache的1.5倍时，将所有序列（包括Cols）和交叉记录裁剪到最近MaxCache个
+*/
 func (e *BarEnv) TrimOverflow() {
 	dataLen := e.Close.Len()
 	trimLen := int(float64(e.MaxCache) * 1.5)
 	if dataLen < trimLen || trimLen <= 0 {
 		return
 	}
-	e.Open.Cut(e.MaxCache)
-	e.High.Cut(e.MaxCache)
-	e.Low.Cut(e.MaxCache)
-	e.Close.Cut(e.MaxCache)
+	e.LockItems.RLock()
+	items := make([]*Series, 0, len(e.Items)+6)
+	for _, s := range e.Items {
+		items = append(items, s)
+	}
+	e.LockItems.RUnlock()
+	// 手动构造的BarEnv中ohlcv可能不在Items中
+	items = append(items, e.roots()...)
+	for _, s := range items {
+		s.trim(e.MaxCache)
+	}
 }
 
 func (e *BarEnv) NewSeries(data []float64) *Series {
-	subs := make(map[string]map[int]*Series)
-	xlogs := make(map[int]*CrossLog)
+	subs := make(map[string]map[string]*Series)
+	xlogs := make(map[string]*CrossLog)
 	res := e.newSeries(data, nil, nil, nil, subs, xlogs)
+	if e.Intrabar {
+		// created in current bar, rollback to empty state
+		res.snap = &seriesSnap{time: res.Time, dataLen: len(data)}
+	}
 	e.VNum += 1
 	e.LockItems.Lock()
 	if e.Items == nil {
@@ -104,12 +346,12 @@ func (e *BarEnv) NewSeries(data []float64) *Series {
 }
 
 func (e *BarEnv) newSeries(data []float64, cols []*Series, more interface{}, dupMore func(interface{}) interface{},
-	subs map[string]map[int]*Series, xlogs map[int]*CrossLog) *Series {
+	subs map[string]map[string]*Series, xlogs map[string]*CrossLog) *Series {
 	if subs == nil {
-		subs = make(map[string]map[int]*Series)
+		subs = make(map[string]map[string]*Series)
 	}
 	if xlogs == nil {
-		xlogs = make(map[int]*CrossLog)
+		xlogs = make(map[string]*CrossLog)
 	}
 	res := &Series{
 		ID:         e.VNum,
@@ -123,12 +365,29 @@ func (e *BarEnv) newSeries(data []float64, cols []*Series, more interface{}, dup
 		XLogs:      xlogs,
 		LockSubMap: make(map[string]*sync.Mutex),
 	}
+	res.usedBar.Store(int64(e.BarNum))
 	for fn := range res.Subs {
 		res.LockSubMap[fn] = &sync.Mutex{}
 	}
 	return res
 }
 
+// String return exchange/market/symbol/timeframe of BarEnv
+func (e *BarEnv) String() string {
+	return fmt.Sprintf("%s/%s/%s/%s", e.Exchange, e.MarketType, e.Symbol, e.TimeFrame)
+}
+
+var envSeq atomic.Int64
+
+// uniqID return an ID unique among all BarEnv in process, assigned on first call
+func (e *BarEnv) uniqID() int64 {
+	if id := e.uid.Load(); id != 0 {
+		return id
+	}
+	e.uid.CompareAndSwap(0, envSeq.Add(1))
+	return e.uid.Load()
+}
+
 func (e *BarEnv) BarCount(start int64) float64 {
 	return float64(e.TimeStop-start) / float64(e.TFMSecs)
 }
@@ -142,12 +401,25 @@ func (e *BarEnv) Clone() *BarEnv {
 		Symbol:     e.Symbol,
 		TimeFrame:  e.TimeFrame,
 		TFMSecs:    e.TFMSecs,
+		Frame:      e.Frame,
 		BarNum:     e.BarNum,
 		MaxCache:   e.MaxCache,
 		VNum:       e.VNum,
 		Items:      make(map[int]*Series),
 		Data:       sync.Map{},
-	}
+		GapPolicy:  e.GapPolicy,
+		GapNum:     e.GapNum,
+		OnGapBar:   e.OnGapBar,
+		Intrabar:   e.Intrabar,
+		EvictIdle:  e.EvictIdle,
+		snapBar:    e.snapBar,
+	}
+	e.lockSubs.Lock()
+	for _, s := range e.subs {
+		// 结果在下一个bar重新计算
+		res.subs = append(res.subs, &envSub{IndSub: s.IndSub, ind: s.ind})
+	}
+	e.lockSubs.Unlock()
 	e.Data.Range(func(key, value interface{}) bool {
 		res.Data.Store(key, value)
 		return true
@@ -170,29 +442,34 @@ func (e *BarEnv) Clone() *BarEnv {
 	if e.Info != nil {
 		res.Info = e.Info.CopyTo(res)
 	}
+	if e.QuoteVolume != nil {
+		res.QuoteVolume = e.QuoteVolume.CopyTo(res)
+		res.TradeNum = e.TradeNum.CopyTo(res)
+		res.BuyVolume = e.BuyVolume.CopyTo(res)
+	}
 	e.LockItems.RLock()
 	itemList := maps.Values(e.Items)
 	e.LockItems.RUnlock()
 	for v := range itemList {
 		v.CopyTo(res)
 	}
+	e.lockAux.Lock()
+	for name, in := range e.aux {
+		if res.aux == nil {
+			res.aux = make(map[string]*auxInput)
+		}
+		res.aux[name] = &auxInput{ser: in.ser.CopyTo(res), pend: slices.Clone(in.pend), last: in.last}
+	}
+	e.lockAux.Unlock()
 	return res
 }
 
-// ResetTo reset all Series to given(exclude ohlcv)
+// ResetTo reset all Series to given(exclude ohlcv and other input Series)
 func (e *BarEnv) ResetTo(env *BarEnv) {
-	rootIds := map[int]bool{
-		env.Open.ID:   true,
-		env.High.ID:   true,
-		env.Low.ID:    true,
-		env.Close.ID:  true,
-		env.Volume.ID: true,
-		env.Info.ID:   true,
-	}
 	env.LockItems.Lock()
 	var items = make([]*Series, 0, len(env.Items))
 	for id, s := range env.Items {
-		if _, ok := rootIds[id]; ok {
+		if env.isRoot(s) {
 			continue
 		}
 		delete(e.Items, id)
@@ -208,6 +485,11 @@ func (e *BarEnv) ResetTo(env *BarEnv) {
 	e.Close.loadEnvSubs()
 	e.Volume.loadEnvSubs()
 	e.Info.loadEnvSubs()
+	for _, s := range e.extCols() {
+		if s != nil {
+			s.loadEnvSubs()
+		}
+	}
 }
 
 func (s *Series) Set(obj interface{}) *Series {
@@ -238,7 +520,7 @@ func (s *Series) Append(obj interface{}) *Series {
 		}
 		for i, v := range arr[1:] {
 			if i >= len(s.Cols) {
-				col := s.To("_", i)
+				col := s.ToKey(Key("_", i))
 				s.Cols = append(s.Cols, col)
 				col.Append(v)
 			} else {
@@ -257,6 +539,7 @@ func (s *Series) Append(obj interface{}) *Series {
 		fmt.Printf("invalid val for Series.Append: %t", obj)
 		panic(ErrInvalidSeriesVal)
 	}
+	s.fireHooks(s.Time)
 	return s
 }
 
@@ -330,86 +613,38 @@ func (s *Series) RangeValid(start, stop int) ([]float64, []int) {
 	return tmp, ids
 }
 
+// Add same as Add[T], obj can be *Series, int, int64, float32 or float64, panic for other types
 func (s *Series) Add(obj interface{}) *Series {
-	res, val := s.objVal("_add", obj)
-	if res.Cached() {
-		return res
-	}
-	res.LockData.Lock()
-	if !res.Cached() {
-		res.Append(s.Get(0) + val)
-	}
-	res.LockData.Unlock()
-	return res
+	return s.calcOp("_add", obj, anyVal(obj), opAdd)
 }
 
+// Sub same as Sub[T], obj can be *Series, int, int64, float32 or float64, panic for other types
 func (s *Series) Sub(obj interface{}) *Series {
-	res, val := s.objVal("_sub", obj)
-	if res.Cached() {
-		return res
-	}
-	res.LockData.Lock()
-	if !res.Cached() {
-		res.Append(s.Get(0) - val)
-	}
-	res.LockData.Unlock()
-	return res
+	return s.calcOp("_sub", obj, anyVal(obj), opSub)
 }
 
+// Mul same as Mul[T], obj can be *Series, int, int64, float32 or float64, panic for other types
 func (s *Series) Mul(obj interface{}) *Series {
-	res, val := s.objVal("_mul", obj)
-	if res.Cached() {
-		return res
-	}
-	res.LockData.Lock()
-	if !res.Cached() {
-		res.Append(s.Get(0) * val)
-	}
-	res.LockData.Unlock()
-	return res
+	return s.calcOp("_mul", obj, anyVal(obj), opMul)
 }
 
+// Div same as Div[T], obj can be *Series, int, int64, float32 or float64, panic for other types
 func (s *Series) Div(obj interface{}) *Series {
-	res, val := s.objVal("_div", obj)
-	if res.Cached() {
-		return res
-	}
-	res.LockData.Lock()
-	if !res.Cached() {
-		res.Append(s.Get(0) / val)
-	}
-	res.LockData.Unlock()
-	return res
+	return s.calcOp("_div", obj, anyVal(obj), opDiv)
 }
 
+// Min same as Min[T], obj can be *Series, int, int64, float32 or float64, panic for other types
 func (s *Series) Min(obj interface{}) *Series {
-	res, val := s.objVal("_min", obj)
-	if res.Cached() {
-		return res
-	}
-	res.LockData.Lock()
-	if !res.Cached() {
-		res.Append(math.Min(s.Get(0), val))
-	}
-	res.LockData.Unlock()
-	return res
+	return s.calcOp("_min", obj, anyVal(obj), math.Min)
 }
 
+// Max same as Max[T], obj can be *Series, int, int64, float32 or float64, panic for other types
 func (s *Series) Max(obj interface{}) *Series {
-	res, val := s.objVal("_max", obj)
-	if res.Cached() {
-		return res
-	}
-	res.LockData.Lock()
-	if !res.Cached() {
-		res.Append(math.Max(s.Get(0), val))
-	}
-	res.LockData.Unlock()
-	return res
+	return s.calcOp("_max", obj, anyVal(obj), math.Max)
 }
 
 func (s *Series) Abs() *Series {
-	res := s.To("_abs", 0)
+	res := s.ToKey(Key("_abs"))
 	if res.Cached() {
 		return res
 	}
@@ -449,8 +684,24 @@ func (s *Series) Cut(keepNum int) {
 	s.Data = s.Data[curLen-keepNum:]
 }
 
+// trim keep the latest keepNum values and cross records of this Series only
+func (s *Series) trim(keepNum int) {
+	s.LockData.Lock()
+	if curLen := len(s.Data); curLen > keepNum {
+		s.Data = s.Data[curLen-keepNum:]
+	}
+	s.LockData.Unlock()
+	s.LockXLogs.Lock()
+	for _, log := range s.XLogs {
+		if histLen := len(log.Hist); histLen > keepNum {
+			log.Hist = log.Hist[histLen-keepNum:]
+		}
+	}
+	s.LockXLogs.Unlock()
+}
+
 func (s *Series) Back(num int) *Series {
-	res := s.To("_back", num)
+	res := s.ToKey(Key("_back", num))
 	if res.Cached() {
 		return res
 	}
@@ -458,7 +709,8 @@ func (s *Series) Back(num int) *Series {
 	if !res.Cached() {
 		endPos := len(s.Data) - num
 		if endPos > 0 {
-			res.Data = s.Data[:endPos]
+			// 限制容量，向res追加时不会覆盖s的数据
+			res.Data = s.Data[:endPos:endPos]
 		} else {
 			res.Data = nil
 		}
@@ -468,30 +720,63 @@ func (s *Series) Back(num int) *Series {
 	return res
 }
 
-func (s *Series) objVal(rel string, obj interface{}) (*Series, float64) {
-	if ser, ok := obj.(*Series); ok {
-		par := s
-		if ser.ID < s.ID {
-			par = ser
+/*
+Key create a ParamKey for derived Series. args can be int, int64, float32, float64, string, bool or *Series,
+they are encoded in order, so different parameters never share the same Series.
+
+创建派生序列的键，参数按顺序编码，不同参数不会共用同一序列
+*/
+func Key(name string, args ...interface{}) ParamKey {
+	if len(args) == 0 {
+		return ParamKey{Name: name}
+	}
+	var b strings.Builder
+	for i, arg := range args {
+		if i > 0 {
+			b.WriteByte(',')
 		}
-		return par.To(rel, ser.ID), ser.Get(0)
-	} else if intVal, ok := obj.(int); ok {
-		return s.To(rel, intVal), float64(intVal)
-	} else if flt32Val, ok := obj.(float32); ok {
-		return s.To(rel, int(flt32Val*10)), float64(flt32Val)
-	} else if fltVal, ok := obj.(float64); ok {
-		return s.To(rel, int(fltVal*10)), fltVal
-	} else {
-		fmt.Printf("invalid val for Series.objVal: %t", obj)
+		b.WriteString(keyArg(arg))
+	}
+	return ParamKey{Name: name, Args: b.String()}
+}
+
+func keyArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case int:
+		return "i" + strconv.Itoa(v)
+	case int64:
+		return "i" + strconv.FormatInt(v, 10)
+	case float32:
+		return "f" + strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return "f" + strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return "s" + strconv.Quote(v)
+	case bool:
+		if v {
+			return "b1"
+		}
+		return "b0"
+	case *Series:
+		return "v" + strconv.Itoa(v.ID)
+	default:
+		fmt.Printf("invalid val for Key: %t", arg)
 		panic(ErrInvalidSeriesVal)
 	}
 }
 
+// To get derived Series by function name and an int param. Use ToKey for multiple params.
 func (s *Series) To(k string, v int) *Series {
+	return s.ToKey(Key(k, v))
+}
+
+// ToKey get or create the derived Series identified by key
+func (s *Series) ToKey(key ParamKey) *Series {
+	k := key.Name
 	s.LockSub.Lock()
 	sub, _ := s.Subs[k]
 	if sub == nil {
-		sub = make(map[int]*Series)
+		sub = make(map[string]*Series)
 		s.Subs[k] = sub
 	}
 	lock, ok := s.LockSubMap[k]
@@ -501,12 +786,14 @@ func (s *Series) To(k string, v int) *Series {
 	}
 	s.LockSub.Unlock()
 	lock.Lock()
-	old, _ := sub[v]
+	old, _ := sub[key.Args]
 	if old == nil {
 		old = s.Env.NewSeries(nil)
-		sub[v] = old
+		sub[key.Args] = old
 	}
 	lock.Unlock()
+	s.markUsed()
+	old.markUsed()
 	return old
 }
 
@@ -531,9 +818,9 @@ func (s *Series) CopyTo(e *BarEnv) *Series {
 	subs := maps.Clone(s.Subs)
 	s.LockSub.Unlock()
 	for fn, idMap := range subs {
-		sub := make(map[int]*Series)
-		for id, v := range idMap {
-			sub[id] = v.CopyTo(e)
+		sub := make(map[string]*Series)
+		for k, v := range idMap {
+			sub[k] = v.CopyTo(e)
 		}
 		subs[fn] = sub
 	}
@@ -544,25 +831,86 @@ func (s *Series) CopyTo(e *BarEnv) *Series {
 		xlogs[id] = v.Clone()
 	}
 	res := e.newSeries(s.Data, cols, nil, s.DupMore, subs, xlogs)
+	// 保留原ID，和Items的键一致，Evict和交叉记录依赖此ID
+	res.ID = s.ID
 	res.More = s.More
 	if s.DupMore != nil && s.More != nil {
 		res.More = s.DupMore(s.More)
 	}
+	res.snap = s.snap
+	res.auxName = s.auxName
+	res.usedBar.Store(s.usedBar.Load())
 	e.LockItems.Lock()
 	e.Items[s.ID] = res
 	e.LockItems.Unlock()
 	return res
 }
 
+func (s *Series) setLast(val float64) {
+	if len(s.Data) > 0 {
+		s.Data[len(s.Data)-1] = val
+	}
+}
+
+func (s *Series) snapshot() {
+	snap := &seriesSnap{time: s.Time, dataLen: len(s.Data), more: s.More}
+	if s.DupMore != nil && s.More != nil {
+		snap.more = s.DupMore(s.More)
+	}
+	s.LockXLogs.Lock()
+	if len(s.XLogs) > 0 {
+		snap.xlogs = make(map[string]xlogSnap, len(s.XLogs))
+		for k, v := range s.XLogs {
+			snap.xlogs[k] = xlogSnap{v.Time, v.PrevVal, len(v.Hist)}
+		}
+	}
+	s.LockXLogs.Unlock()
+	s.snap = snap
+}
+
+func (s *Series) rollback(withData bool) {
+	snap := s.snap
+	if snap == nil {
+		return
+	}
+	if withData {
+		s.LockData.Lock()
+		s.Time = snap.time
+		if len(s.Data) > snap.dataLen {
+			s.Data = s.Data[:snap.dataLen]
+		}
+		s.More = snap.more
+		if s.DupMore != nil && snap.more != nil {
+			// keep snapshot unchanged for later updates
+			s.More = s.DupMore(snap.more)
+		}
+		s.LockData.Unlock()
+	}
+	s.LockXLogs.Lock()
+	for k, v := range s.XLogs {
+		old, ok := snap.xlogs[k]
+		if !ok {
+			delete(s.XLogs, k)
+			continue
+		}
+		v.Time = old.time
+		v.PrevVal = old.prevVal
+		if len(v.Hist) > old.histLen {
+			v.Hist = v.Hist[:old.histLen]
+		}
+	}
+	s.LockXLogs.Unlock()
+}
+
 func (s *Series) loadEnvSubs() {
 	s.Env.LockItems.RLock()
 	envItems := maps.Clone(s.Env.Items)
 	s.Env.LockItems.RUnlock()
 	for _, idMap := range s.Subs {
-		for id := range idMap {
-			dup, ok := envItems[id]
+		for k, v := range idMap {
+			dup, ok := envItems[v.ID]
 			if ok {
-				idMap[id] = dup
+				idMap[k] = dup
 			}
 		}
 	}
@@ -573,28 +921,18 @@ Cross 计算最近一次交叉的距离。比较对象必须是常数或Series
 返回值：正数上穿，负数下穿，0表示未知或重合；abs(ret) - 1表示交叉点与当前bar的距离
 */
 func (s *Series) Cross(obj2 interface{}) int {
+	return s.crossVal(keyArg(obj2), anyVal(obj2))
+}
+
+// crossVal update the cross log of key with current value v2 of the compared object
+func (s *Series) crossVal(key string, v2 float64) int {
 	var env = s.Env
-	var key int
-	var v2 float64
-	if se2, ok := obj2.(*Series); ok {
-		key = -se2.ID
-		v2 = se2.Get(0)
-	} else if intVal, ok := obj2.(int); ok {
-		key = intVal
-		v2 = float64(intVal)
-	} else if flt32Val, ok := obj2.(float32); ok {
-		key = int(flt32Val * 100)
-		v2 = float64(flt32Val)
-	} else if fltVal, ok := obj2.(float64); ok {
-		key = int(fltVal * 100)
-		v2 = fltVal
-	} else {
-		fmt.Printf("invalid val for Series.objVal: %t", obj2)
-		panic(ErrInvalidSeriesVal)
-	}
 	var newData = false
 	var log *CrossLog
+	diffVal := s.Get(0) - v2
+	// 交叉历史可能被其他协程读取，全部在锁内更新
 	s.LockXLogs.Lock()
+	defer s.LockXLogs.Unlock()
 	if val, ok := s.XLogs[key]; ok {
 		log = val
 		if env.TimeStart > log.Time {
@@ -606,9 +944,7 @@ func (s *Series) Cross(obj2 interface{}) int {
 		log = &CrossLog{env.TimeStart, math.NaN(), []*XState{}}
 		s.XLogs[key] = log
 	}
-	s.LockXLogs.Unlock()
 	if newData {
-		diffVal := s.Get(0) - v2
 		if diffVal != 0 && !math.IsNaN(diffVal) {
 			if math.IsNaN(log.PrevVal) {
 				log.PrevVal = diffVal
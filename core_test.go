@@ -1,6 +1,9 @@
 package banta
 
 import (
+	"errors"
+	"math"
+	"runtime"
 	"slices"
 	"strconv"
 	"strings"
@@ -218,3 +221,457 @@ func runAndCompareCases(t *testing.T, klineData []Kline, items []CaseItem, showT
 		})
 	}
 }
+
+// TestOnBarUpdate 测试未完成K线多次更新后，指标结果与只推送完成K线一致
+func TestOnBarUpdate(t *testing.T) {
+	calcInds := func(e *BarEnv) []float64 {
+		k, d, _ := KDJ(e.High, e.Low, e.Close, 9, 3, 3)
+		macd, sig := MACD(e.Close, 12, 26, 9)
+		return []float64{
+			SMA(e.Close, 5).Get(0),
+			RSI(e.Close, 14).Get(0),
+			k.Get(0),
+			d.Get(0),
+			macd.Get(0),
+			sig.Get(0),
+			ATR(e.High, e.Low, e.Close, 14).Get(0),
+			float64(e.Close.Cross(30000)),
+		}
+	}
+	closed, _ := NewBarEnv("binance", "spot", "", "1d")
+	live, _ := NewBarEnv("binance", "spot", "", "1d")
+	for i, k := range DataKline {
+		err := closed.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expects := calcInds(closed)
+		// 先推送两次未完成的K线
+		err = live.OnBarUpdate(k.Time, k.Open, k.Open, k.Open, k.Open, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		calcInds(live)
+		err = live.OnBarUpdate(k.Time, k.Open, k.High, k.Low, (k.High+k.Low)/2, k.Volume/2, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		calcInds(live)
+		err = live.OnBarUpdate(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := calcInds(live)
+		for j, v := range results {
+			if !equalNearly(v, expects[j]) {
+				t.Fatalf("bar %d ind %d: expect %v, got %v", i, j, expects[j], v)
+			}
+		}
+	}
+	if err := live.OnBarUpdate(DataKline[0].Time, 1, 1, 1, 1, 1, 0); err == nil {
+		t.Error("expect error for old bar update")
+	}
+}
+
+func TestParamKey(t *testing.T) {
+	if Key("_x", 1, 2.0) == Key("_x", 1, 2) || Key("_x", 12) == Key("_x", 1, 2) || Key("_x", "a,b") == Key("_x", "a", "b") {
+		t.Error("different params should not share key")
+	}
+	if Key("_bb", 20, 2.0, 2.0) != Key("_bb", 20, 2.0, 2.0) {
+		t.Error("same params should share key")
+	}
+	testEnv, _ := NewBarEnv("binance", "spot", "", "1d")
+	for _, k := range DataKline[:30] {
+		_ = testEnv.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		a, b := testEnv.Close.Add(1.0), testEnv.Close.Add(1.01)
+		if a == b || !equalNearly(b.Get(0)-a.Get(0), 0.01) {
+			t.Fatalf("Add(1.0) and Add(1.01) should be different series")
+		}
+		up1, _, _ := BBANDS(testEnv.Close, 20, 2, 1.5)
+		up2, _, _ := BBANDS(testEnv.Close, 20, 2, 1.59)
+		if up1 == up2 {
+			t.Fatalf("BBANDS with different stdDn should be different series")
+		}
+	}
+}
+
+func TestBarGap(t *testing.T) {
+	klines := append([]Kline{}, DataKline[:10]...)
+	klines = append(klines, DataKline[13:20]...)
+	runBars := func(e *BarEnv, bars []Kline) error {
+		for _, k := range bars {
+			if err := e.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info); err != nil {
+				return err
+			}
+			SMA(e.Close, 3)
+		}
+		return nil
+	}
+	runGap := func(policy int) (*BarEnv, error) {
+		e, _ := NewBarEnv("binance", "spot", "", "1d")
+		e.GapPolicy = policy
+		return e, runBars(e, klines)
+	}
+	e, err := runGap(GapIgnore)
+	if err != nil || e.Close.Len() != 17 || e.GapNum != 0 {
+		t.Errorf("GapIgnore: %v %d %d", err, e.Close.Len(), e.GapNum)
+	}
+	e, err = runGap(GapError)
+	if !errors.Is(err, ErrBarGap) || e.Close.Len() != 10 {
+		t.Errorf("GapError: %v %d", err, e.Close.Len())
+	}
+	e, err = runGap(GapFill)
+	if err != nil || e.Close.Len() != 20 || e.GapNum != 3 || e.BarNum != 20 {
+		t.Fatalf("GapFill: %v %d %d", err, e.Close.Len(), e.GapNum)
+	}
+	for i := 7; i <= 9; i++ {
+		if e.Close.Get(i) != DataKline[9].Close || e.High.Get(i) != DataKline[9].Close || e.Volume.Get(i) != 0 {
+			t.Errorf("GapFill bad bar %d: %v %v", i, e.Close.Get(i), e.Volume.Get(i))
+		}
+	}
+	if e.TimeStart != DataKline[19].Time {
+		t.Errorf("GapFill bad time: %d", e.TimeStart)
+	}
+	// 未在插入的K线上计算的指标补充NaN
+	ma := SMA(e.Close, 3)
+	if ma.Len() != e.Close.Len() || !math.IsNaN(ma.Get(8)) {
+		t.Errorf("GapFill expect sma aligned with close, got %d %v", ma.Len(), ma.Get(8))
+	}
+	// OnGapBar中计算时和没有缺失的K线一致
+	filled := slices.Clone(DataKline[:20])
+	for i := 10; i < 13; i++ {
+		c := DataKline[9].Close
+		filled[i] = Kline{Time: DataKline[i].Time, Open: c, High: c, Low: c, Close: c, Info: DataKline[9].Info}
+	}
+	ref, _ := NewBarEnv("binance", "spot", "", "1d")
+	if err = runBars(ref, filled); err != nil {
+		t.Fatal(err)
+	}
+	e, _ = NewBarEnv("binance", "spot", "", "1d")
+	e.GapPolicy = GapFill
+	e.OnGapBar = func(e *BarEnv) {
+		SMA(e.Close, 3)
+	}
+	if err = runBars(e, klines); err != nil {
+		t.Fatal(err)
+	}
+	ma, exp := SMA(e.Close, 3), SMA(ref.Close, 3)
+	if ma.Len() != exp.Len() || ma.Len() != e.Close.Len() {
+		t.Fatalf("OnGapBar: expect %d sma, got %d", exp.Len(), ma.Len())
+	}
+	for i := 0; i < exp.Len(); i++ {
+		if !equalNearly(ma.Get(i), exp.Get(i)) {
+			t.Fatalf("OnGapBar sma %d: expect %v, got %v", i, exp.Get(i), ma.Get(i))
+		}
+	}
+	// Back引用Close的数据，补充NaN时不能覆盖Close
+	e, _ = NewBarEnv("binance", "spot", "", "1d")
+	e.GapPolicy = GapFill
+	for _, k := range klines {
+		_ = e.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		e.Close.Back(1)
+		SMA(e.Close.Back(1), 2)
+	}
+	if closes := e.Close.Range(0, 20); slices.ContainsFunc(closes, math.IsNaN) ||
+		closes[0] != DataKline[19].Close || closes[10] != DataKline[9].Close {
+		t.Errorf("GapFill Back should not change close: %v", closes)
+	}
+	if back := e.Close.Back(1); back.Len() != 19 || back.Get(0) != DataKline[18].Close {
+		t.Errorf("GapFill bad back: %d %v", back.Len(), back.Get(0))
+	}
+	e, err = runGap(GapNaN)
+	if err != nil || e.Close.Len() != 20 || e.GapNum != 3 || !math.IsNaN(e.Close.Get(8)) {
+		t.Errorf("GapNaN: %v %d %d %v", err, e.Close.Len(), e.GapNum, e.Close.Get(8))
+	}
+}
+
+func TestTrimOverflow(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip long running test in short mode")
+	}
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1s")
+	env.MaxCache = 100
+	calcInds := func() {
+		SMA(env.Close, 20)
+		RSI(env.Close, 14)
+		KDJ(env.High, env.Low, env.Close, 9, 3, 3)
+		BBANDS(env.Close, 20, 2, 2)
+		MACD(env.Close, 12, 26, 9)
+		ATR(env.High, env.Low, env.Close, 14)
+		MFI(env, 14)
+		env.Close.Cross(EMA(env.Close, 5))
+		env.Close.Cross(EMA(env.Close, 10))
+	}
+	barNum := 1000000
+	price, heapMid := 100.0, uint64(0)
+	var mem runtime.MemStats
+	for i := 0; i < barNum; i++ {
+		// 确定性的锯齿波，保证足够多的交叉
+		price += math.Sin(float64(i) / 3)
+		_ = env.OnBar(int64(i)*1000, price, price+1, price-1, price, 10, 0)
+		calcInds()
+		if i == barNum/4 {
+			runtime.GC()
+			runtime.ReadMemStats(&mem)
+			heapMid = mem.HeapAlloc
+		}
+	}
+	maxLen := int(float64(env.MaxCache) * 1.5)
+	for _, s := range env.Items {
+		if s.Len() > maxLen {
+			t.Errorf("series %d not trimmed: %d", s.ID, s.Len())
+		}
+		for k, log := range s.XLogs {
+			if len(log.Hist) > maxLen {
+				t.Errorf("cross log %d/%s not trimmed: %d", s.ID, k, len(log.Hist))
+			}
+		}
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&mem)
+	if mem.HeapAlloc > heapMid*2+(1<<20) {
+		t.Errorf("memory grows from %d to %d", heapMid, mem.HeapAlloc)
+	}
+}
+
+func TestCloneEvict(t *testing.T) {
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	for _, k := range DataKline[:30] {
+		_ = env.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		SMA(env.Close, 5)
+		env.Close.Cross(EMA(env.Close, 10))
+	}
+	clone := env.Clone()
+	if len(clone.Items) != len(env.Items) {
+		t.Fatalf("expect %d series in clone, got %d", len(env.Items), len(clone.Items))
+	}
+	// 复制的序列保留原ID，和Items的键一致
+	for id, s := range clone.Items {
+		if s.ID != id || s.Env != clone || s == env.Items[id] {
+			t.Fatalf("bad clone series %d: id %d", id, s.ID)
+		}
+	}
+	for _, k := range DataKline[30:40] {
+		_ = clone.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		SMA(clone.Close, 5)
+	}
+	if num := clone.Evict(5); num == 0 || len(clone.Close.Subs["_ema"]) > 0 || len(clone.Close.XLogs) > 0 {
+		t.Errorf("expect ema evicted in clone, removed %d", num)
+	}
+	if len(env.Close.Subs["_ema"]) != 1 || len(env.Close.XLogs) != 1 {
+		t.Error("evict on clone should not change the origin")
+	}
+	exp := SMA(env.Close, 5).Get(0)
+	for _, k := range DataKline[30:40] {
+		_ = env.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		exp = SMA(env.Close, 5).Get(0)
+	}
+	if val := SMA(clone.Close, 5).Get(0); !equalNearly(val, exp) {
+		t.Errorf("expect clone sma %v, got %v", exp, val)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	half := len(DataKline) / 2
+	var expects, results []float64
+	RunFakeEnv(env, DataKline, func(i int, k Kline) {
+		ma := SMA(env.Close, 5)
+		env.Close.Cross(ma)
+		if i < half {
+			// 参数扫描，只在前半段访问
+			for p := 2; p < 20; p++ {
+				env.Close.Cross(EMA(env.Close, p))
+			}
+			RSI(SMA(env.Close, 3), 6)
+			return
+		}
+		if i == half+5 {
+			env.Evict(5)
+			// 只保留ohlcv和SMA(5)及其依赖的Sum
+			if len(env.Items) != 8 {
+				t.Errorf("expect 8 series after evict, got %d", len(env.Items))
+			}
+			if len(env.Close.XLogs) != 1 {
+				t.Errorf("cross logs should be removed, left %d", len(env.Close.XLogs))
+			}
+			clone := env.Clone()
+			clone.ResetTo(env)
+			if len(clone.Items) != len(env.Items) {
+				t.Errorf("clone items mismatch: %d %d", len(clone.Items), len(env.Items))
+			}
+		}
+		expects = append(expects, ma.Get(0))
+		results = append(results, SMA(env.Close, 5).Get(0))
+	})
+	if num := len(env.Close.Subs["_ema"]); num > 0 {
+		t.Errorf("ema should be evicted, left %d", num)
+	}
+	for id, s := range env.Items {
+		if s.UsedBar() < env.BarNum-1 && !env.isRoot(s) {
+			t.Errorf("series %d not used since %d", id, s.UsedBar())
+		}
+	}
+	for i, v := range results {
+		if !equalNearly(v, expects[i]) {
+			t.Fatalf("bar %d: expect %v, got %v", i, expects[i], v)
+		}
+	}
+
+	// 自动移除
+	env2, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	env2.EvictIdle = 3
+	maxNum := 0
+	RunFakeEnv(env2, DataKline, func(i int, k Kline) {
+		SMA(env2.Close, 2+i).Get(0)
+		maxNum = max(maxNum, len(env2.Items))
+	})
+	// 每个bar新增SMA和Sum两个序列
+	if maxNum > 6+env2.EvictIdle*4 {
+		t.Errorf("automatic evict not work, max items: %d", maxNum)
+	}
+}
+
+func TestOperand(t *testing.T) {
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	RunFakeEnv(env, DataKline, func(i int, k Kline) {
+		c, h, l := env.Close, env.High, env.Low
+		if Add(c, 2) != c.Add(2) || Mul(c, 1.5) != c.Mul(1.5) || Sub(h, l) != h.Sub(l) {
+			t.Fatal("method should return the same Series as generic function")
+		}
+		if Add(c, 2) == Add(c, 2.0) {
+			t.Fatal("int and float operands should use different Series")
+		}
+		checks := map[string][2]float64{
+			"add":   {Add(c, int64(3)).Get(0), k.Close + 3},
+			"h-l":   {Sub(h, l).Get(0), k.High - k.Low},
+			"c-l":   {Sub(c, l).Get(0), k.Close - k.Low},
+			"l-c":   {Sub(l, c).Get(0), k.Low - k.Close},
+			"div":   {Div(h, l).Get(0), k.High / k.Low},
+			"min":   {Min(c, float32(k.Open)).Get(0), min(k.Close, float64(float32(k.Open)))},
+			"max":   {Max(l, h).Get(0), k.High},
+			"h-l-c": {Sub(Sub(h, l), c).Get(0), k.High - k.Low - k.Close},
+		}
+		for name, v := range checks {
+			if !equalNearly(v[0], v[1]) {
+				t.Fatalf("bar %d %s: expect %v, got %v", i, name, v[1], v[0])
+			}
+		}
+		if CrossOf(c, SMA(c, 5)) != c.Cross(SMA(c, 5)) {
+			t.Fatal("CrossOf mismatch with Series.Cross")
+		}
+	})
+	defer func() {
+		if err, ok := recover().(error); !ok || !errors.Is(err, ErrInvalidSeriesVal) {
+			t.Errorf("expect ErrInvalidSeriesVal, got %v", err)
+		}
+	}()
+	env.Close.Add("1")
+}
+
+func TestOperators(t *testing.T) {
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	nan := math.NaN()
+	RunFakeEnv(env, DataKline, func(i int, k Kline) {
+		c, o := env.Close, env.Open
+		up := Greater(c, o)
+		diff := c.Sub(o)
+		ma := SMA(c, 3)
+		isUp := boolVal(k.Close > k.Open)
+		checks := map[string][2]float64{
+			"pow":     {Pow(c, 2).Get(0), k.Close * k.Close},
+			"sqrt":    {c.Sqrt().Get(0), math.Sqrt(k.Close)},
+			"log":     {c.Log().Exp().Get(0), k.Close},
+			"neg":     {c.Neg().Get(0), -k.Close},
+			"sign":    {diff.Sign().Get(0), math.Copysign(1, k.Close-k.Open)},
+			"round":   {c.Round(-2).Get(0), math.Round(k.Close/100) * 100},
+			"clamp":   {c.Clamp(k.Low, k.Open).Get(0), min(k.Close, k.Open)},
+			"greater": {up.Get(0), isUp},
+			"less":    {Less(c, o).Get(0), boolVal(k.Close < k.Open)},
+			"equal":   {Equal(c, c).Get(0), 1},
+			"and":     {And(up, Greater(c, k.Low)).Get(0), isUp},
+			"or":      {Or(up, 0).Get(0), isUp},
+			"not":     {up.Not().Get(0), 1 - isUp},
+			"iif":     {IIf(up, c, 0).Get(0), k.Close * isUp},
+		}
+		if i < 2 {
+			// SMA未就绪时为NaN，比较和选择结果也是NaN
+			checks["nan-gt"] = [2]float64{Greater(c, ma).Get(0), nan}
+			checks["nan-not"] = [2]float64{Greater(c, ma).Not().Get(0), nan}
+			checks["nan-iif"] = [2]float64{IIf(Greater(c, ma), 1, 0).Get(0), nan}
+		}
+		for name, v := range checks {
+			if !equalNearly(v[0], v[1]) {
+				t.Fatalf("bar %d %s: expect %v, got %v", i, name, v[1], v[0])
+			}
+		}
+	})
+}
+
+func TestCrossHistConcurrent(t *testing.T) {
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	env.MaxCache = 10
+	RunFakeEnv(env, DataKline, func(i int, k Kline) {
+		ma1, ma2 := SMA(env.Close, 3), SMA(env.Close, 6)
+		var wg sync.WaitGroup
+		// 多个策略在同一bar并发读取和更新交叉记录
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ma1.Cross(ma2)
+				ma1.CrossHist(ma2, 3)
+				ma1.CrossCount(ma2, 5)
+				ma1.CrossGaps(ma2, 2)
+			}()
+		}
+		wg.Wait()
+	})
+	if len(env.Close.Subs) == 0 || len(SMA(env.Close, 3).XLogs) != 1 {
+		t.Error("expect cross log kept")
+	}
+}
+
+func TestCrossHist(t *testing.T) {
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	var hist []XState
+	RunFakeEnv(env, DataKline, func(i int, k Kline) {
+		ma1, ma2 := SMA(env.Close, 3), SMA(env.Close, 6)
+		xOver, xUnder := CrossOver(ma1, ma2).Get(0), ma1.CrossUnder(ma2).Get(0)
+		flag := ma1.Cross(ma2)
+		if flag == 1 || flag == -1 {
+			hist = append(hist, XState{flag, env.BarNum})
+		}
+		if xOver != boolVal(flag == 1) || xUnder != boolVal(flag == -1) {
+			t.Fatalf("bar %d cross flags mismatch: %d %v %v", i, flag, xOver, xUnder)
+		}
+		last := ma1.CrossHist(ma2, 3)
+		if len(last) != min(3, len(hist)) {
+			t.Fatalf("bar %d expect %d crosses, got %d", i, min(3, len(hist)), len(last))
+		}
+		for j, x := range last {
+			if x != hist[len(hist)-1-j] {
+				t.Fatalf("bar %d cross %d mismatch: %v %v", i, j, x, hist[len(hist)-1-j])
+			}
+		}
+		count := 0
+		for _, x := range hist {
+			if x.BarNum > env.BarNum-10 {
+				count += 1
+			}
+		}
+		if num := ma1.CrossCount(ma2, 10); num != count {
+			t.Fatalf("bar %d expect %d crosses in window, got %d", i, count, num)
+		}
+		gaps := ma1.CrossGaps(ma2, 2)
+		for j, gap := range gaps {
+			n := len(hist) - 1 - j
+			if gap != hist[n].BarNum-hist[n-1].BarNum {
+				t.Fatalf("bar %d gap %d mismatch: %d", i, j, gap)
+			}
+		}
+	})
+	if len(hist) < 5 {
+		t.Errorf("too few crosses: %d", len(hist))
+	}
+}
@@ -0,0 +1,122 @@
+package banta
+
+import "slices"
+
+/*
+Last return the latest num crosses, newest first. Sign is 1 for cross over and -1 for cross under,
+BarNum is BarEnv.BarNum when crossed.
+
+返回最近num次交叉，最新的在前。Sign为1上穿，-1下穿；BarNum为交叉时的BarEnv.BarNum
+*/
+func (c *CrossLog) Last(num int) []XState {
+	histLen := len(c.Hist)
+	num = min(num, histLen)
+	res := make([]XState, 0, num)
+	for i := histLen - 1; i >= histLen-num; i-- {
+		res = append(res, *c.Hist[i])
+	}
+	return res
+}
+
+// CountSince return the number of crosses whose BarNum >= barNum
+func (c *CrossLog) CountSince(barNum int) int {
+	num := 0
+	for i := len(c.Hist) - 1; i >= 0 && c.Hist[i].BarNum >= barNum; i-- {
+		num += 1
+	}
+	return num
+}
+
+/*
+Gaps return the number of bars between consecutive crosses, newest first, at most num items.
+
+返回相邻两次交叉间隔的bar数，最新的在前，最多num个
+*/
+func (c *CrossLog) Gaps(num int) []int {
+	histLen := len(c.Hist)
+	num = min(num, histLen-1)
+	if num <= 0 {
+		return nil
+	}
+	res := make([]int, 0, num)
+	for i := histLen - 1; i >= histLen-num; i-- {
+		res = append(res, c.Hist[i].BarNum-c.Hist[i-1].BarNum)
+	}
+	return res
+}
+
+// crossLog update the cross state with obj on current bar and return a copy of the log made under lock
+func (s *Series) crossLog(obj interface{}) *CrossLog {
+	key := keyArg(obj)
+	s.crossVal(key, anyVal(obj))
+	s.LockXLogs.Lock()
+	defer s.LockXLogs.Unlock()
+	log := s.XLogs[key]
+	// XState添加后不再修改，复制切片即可
+	return &CrossLog{Time: log.Time, PrevVal: log.PrevVal, Hist: slices.Clone(log.Hist)}
+}
+
+/*
+CrossHist return the latest num crosses between s and obj, newest first. see CrossLog.Last
+
+返回s和obj最近num次交叉，最新的在前
+*/
+func (s *Series) CrossHist(obj interface{}, num int) []XState {
+	return s.crossLog(obj).Last(num)
+}
+
+/*
+CrossCount return the number of crosses between s and obj in latest window bars (including current bar)
+
+返回最近window个bar（含当前bar）内s和obj的交叉次数
+*/
+func (s *Series) CrossCount(obj interface{}, window int) int {
+	return s.crossLog(obj).CountSince(s.Env.BarNum - window + 1)
+}
+
+// CrossGaps return the number of bars between consecutive crosses of s and obj, newest first
+func (s *Series) CrossGaps(obj interface{}, num int) []int {
+	return s.crossLog(obj).Gaps(num)
+}
+
+// crossFlag 1 if s crosses obj in given direction on current bar, else 0
+func crossFlag(s *Series, rel string, obj interface{}, sign int) *Series {
+	res := s.ToKey(Key(rel, obj))
+	if res.Cached() {
+		return res
+	}
+	res.LockData.Lock()
+	if !res.Cached() {
+		res.Append(boolVal(s.crossVal(keyArg(obj), anyVal(obj)) == sign))
+	}
+	res.LockData.Unlock()
+	return res
+}
+
+/*
+CrossOver 1 on the bar when s crosses over obj, else 0
+
+s上穿obj的bar为1，否则为0
+*/
+func CrossOver[T Operand](s *Series, obj T) *Series {
+	return crossFlag(s, "_xover", obj, 1)
+}
+
+/*
+CrossUnder 1 on the bar when s crosses under obj, else 0
+
+s下穿obj的bar为1，否则为0
+*/
+func CrossUnder[T Operand](s *Series, obj T) *Series {
+	return crossFlag(s, "_xunder", obj, -1)
+}
+
+// CrossOver same as CrossOver[T]
+func (s *Series) CrossOver(obj interface{}) *Series {
+	return crossFlag(s, "_xover", obj, 1)
+}
+
+// CrossUnder same as CrossUnder[T]
+func (s *Series) CrossUnder(obj interface{}) *Series {
+	return crossFlag(s, "_xunder", obj, -1)
+}
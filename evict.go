@@ -0,0 +1,117 @@
+package banta
+
+import (
+	"strconv"
+	"strings"
+)
+
+// markUsed record current bar number as the last access of this Series and its columns
+func (s *Series) markUsed() {
+	num := int64(s.Env.BarNum)
+	if s.usedBar.Load() == num {
+		return
+	}
+	s.usedBar.Store(num)
+	for _, col := range s.Cols {
+		col.markUsed()
+	}
+}
+
+// UsedBar return the BarNum when this Series was last accessed
+func (s *Series) UsedBar() int {
+	return int(s.usedBar.Load())
+}
+
+/*
+Evict remove derived Series which were not accessed in the latest idleBars bars, together with all Series
+derived from them. OHLCV are never removed. Return the number of removed Series.
+
+Calling an indicator again after eviction creates a new Series and computes from current bar.
+
+移除最近idleBars个bar内未被访问的派生序列及其所有子序列，ohlcv不会被移除。返回移除的数量。
+移除后再次调用指标会从当前bar重新计算。
+*/
+func (e *BarEnv) Evict(idleBars int) int {
+	if idleBars <= 0 {
+		return 0
+	}
+	minBar, curBar := int64(e.BarNum-idleBars), int64(e.BarNum)
+	e.LockItems.Lock()
+	drops := make(map[int]*Series)
+	var addTree func(s *Series)
+	addTree = func(s *Series) {
+		if _, ok := drops[s.ID]; ok {
+			return
+		}
+		drops[s.ID] = s
+		s.LockSub.Lock()
+		children := make([]*Series, 0, len(s.Subs))
+		for _, sub := range s.Subs {
+			for _, v := range sub {
+				children = append(children, v)
+			}
+		}
+		s.LockSub.Unlock()
+		for _, v := range children {
+			addTree(v)
+		}
+	}
+	for _, s := range e.Items {
+		used := s.usedBar.Load()
+		// used大于当前BarNum说明是Reset之前的序列
+		if !e.isRoot(s) && (used < minBar || used > curBar) {
+			addTree(s)
+		}
+	}
+	if len(drops) == 0 {
+		e.LockItems.Unlock()
+		return 0
+	}
+	for id := range drops {
+		delete(e.Items, id)
+	}
+	items := make([]*Series, 0, len(e.Items))
+	for _, s := range e.Items {
+		items = append(items, s)
+	}
+	// ToKey创建序列时持有子锁再获取LockItems，这里需先释放LockItems
+	e.LockItems.Unlock()
+	for _, s := range items {
+		s.dropRefs(drops)
+	}
+	return len(drops)
+}
+
+// dropRefs remove sub Series and cross logs which refer to removed Series
+func (s *Series) dropRefs(drops map[int]*Series) {
+	s.LockSub.Lock()
+	for name, sub := range s.Subs {
+		// ToKey在此锁内修改sub
+		lock, ok := s.LockSubMap[name]
+		if ok {
+			lock.Lock()
+		}
+		for k, v := range sub {
+			if _, ok := drops[v.ID]; ok {
+				delete(sub, k)
+			}
+		}
+		if ok {
+			lock.Unlock()
+		}
+	}
+	s.LockSub.Unlock()
+	s.LockXLogs.Lock()
+	for k := range s.XLogs {
+		// 和Series比较的交叉记录，键为"v"+ID
+		if !strings.HasPrefix(k, "v") {
+			continue
+		}
+		if id, err := strconv.Atoi(k[1:]); err == nil {
+			if _, ok := drops[id]; ok {
+				delete(s.XLogs, k)
+			}
+		}
+	}
+	s.LockXLogs.Unlock()
+}
@@ -0,0 +1,734 @@
+package banta
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/banbox/banta/tav"
+)
+
+/*
+Expr a compiled formula expression, such as `EMA(close,12)-EMA(close,26) > 0 AND RSI(close,14) < 30`.
+
+Supported syntax:
+  - variables: open, high, low, close, volume, info, quote, trades, buy (extended fields, see BarEnv.OnKline)
+  - numbers, parentheses, function calls, such as SMA(close,20), ATR(high,low,close,14), CROSSOVER(a,b), IIF(cond,a,b)
+  - all indicators in registry return their first output, those reading BarEnv only take params, such as WillR(14)
+  - operators by precedence: OR (||), AND (&&), NOT (!), comparisons (> < >= <= == !=), + -, * /, unary -, ^
+
+Names of variables, functions and keywords are case-insensitive. Comparisons and logical operators return 0/1, NaN if any input is NaN.
+
+公式表达式，可编译为Series实时计算，或基于tav的向量计算
+*/
+type Expr struct {
+	Text string
+	root *exprNode
+}
+
+type exprNode struct {
+	op   string // num, var, call, neg, not 或二元运算符
+	num  float64
+	name string
+	args []*exprNode
+	fn   *exprFunc // op为call时调用的函数
+	pos  int
+}
+
+// exprVal value of a node when evaluating, ser is nil for constant
+type exprVal struct {
+	ser *Series
+	num float64
+}
+
+// exprVec value of a node when evaluating vectors, arr is nil for constant
+type exprVec struct {
+	arr []float64
+	num float64
+}
+
+/*
+exprFunc a function which can be called in Expr. The first `series` arguments accept series,
+the following `params` arguments must be constant numbers.
+*/
+type exprFunc struct {
+	series int
+	params int
+	live   func(e *BarEnv, ins []*Series, params []float64) *Series
+	vec    func(ins [][]float64, params []float64) []float64
+}
+
+var exprVars = map[string]bool{
+	"open": true, "high": true, "low": true, "close": true, "volume": true, "info": true,
+	"quote": true, "trades": true, "buy": true,
+}
+
+// exprOps calculate binary operators on values, NaN conventions are the same as Series operators
+var exprOps = map[string]func(a, b float64) float64{
+	"+":   opAdd,
+	"-":   opSub,
+	"*":   opMul,
+	"/":   opDiv,
+	"^":   math.Pow,
+	">":   opGreater,
+	"<":   opLess,
+	">=":  compareOp(func(a, b float64) bool { return a >= b }),
+	"<=":  compareOp(func(a, b float64) bool { return a <= b }),
+	"==":  opEqual,
+	"!=":  compareOp(func(a, b float64) bool { return a != b }),
+	"AND": opAnd,
+	"OR":  opOr,
+}
+
+func opNot(v float64) float64 {
+	if math.IsNaN(v) {
+		return v
+	}
+	return boolVal(v == 0)
+}
+
+// mapVec apply calc on each item of data
+func mapVec(data []float64, calc func(v float64) float64) []float64 {
+	res := make([]float64, len(data))
+	for i, v := range data {
+		res[i] = calc(v)
+	}
+	return res
+}
+
+func unaryFunc(fn func(s *Series) *Series, calc func(v float64) float64) *exprFunc {
+	return &exprFunc{
+		series: 1,
+		live: func(e *BarEnv, ins []*Series, params []float64) *Series {
+			return fn(ins[0])
+		},
+		vec: func(ins [][]float64, params []float64) []float64 {
+			return mapVec(ins[0], calc)
+		},
+	}
+}
+
+func binaryFunc(fn func(a, b *Series) *Series, calc func(a, b float64) float64) *exprFunc {
+	return &exprFunc{
+		series: 2,
+		live: func(e *BarEnv, ins []*Series, params []float64) *Series {
+			return fn(ins[0], ins[1])
+		},
+		vec: func(ins [][]float64, params []float64) []float64 {
+			res := make([]float64, len(ins[0]))
+			for i, v := range ins[0] {
+				res[i] = calc(v, ins[1][i])
+			}
+			return res
+		},
+	}
+}
+
+func crossFunc(sign int) *exprFunc {
+	return &exprFunc{
+		series: 2,
+		live: func(e *BarEnv, ins []*Series, params []float64) *Series {
+			if sign > 0 {
+				return CrossOver(ins[0], ins[1])
+			}
+			return CrossUnder(ins[0], ins[1])
+		},
+		vec: func(ins [][]float64, params []float64) []float64 {
+			flags := tav.Cross(ins[0], ins[1])
+			res := make([]float64, len(flags))
+			for i, v := range flags {
+				res[i] = boolVal(v == sign)
+			}
+			return res
+		},
+	}
+}
+
+// exprFuncs functions which can be used in Expr besides indicators in registry, keys are upper case names
+var exprFuncs = map[string]*exprFunc{
+	"IIF": {
+		series: 3,
+		live: func(e *BarEnv, ins []*Series, params []float64) *Series {
+			return IIf(ins[0], ins[1], ins[2])
+		},
+		vec: func(ins [][]float64, params []float64) []float64 {
+			res := make([]float64, len(ins[0]))
+			for i, flag := range ins[0] {
+				if math.IsNaN(flag) {
+					res[i] = math.NaN()
+				} else if flag != 0 {
+					res[i] = ins[1][i]
+				} else {
+					res[i] = ins[2][i]
+				}
+			}
+			return res
+		},
+	},
+	"ROUND": {
+		series: 1,
+		params: 1,
+		live: func(e *BarEnv, ins []*Series, params []float64) *Series {
+			return ins[0].Round(int(params[0]))
+		},
+		vec: func(ins [][]float64, params []float64) []float64 {
+			scale := math.Pow10(int(params[0]))
+			return mapVec(ins[0], func(v float64) float64 {
+				return math.Round(v*scale) / scale
+			})
+		},
+	},
+	"CROSSOVER":  crossFunc(1),
+	"CROSSUNDER": crossFunc(-1),
+	"ABS":        unaryFunc((*Series).Abs, math.Abs),
+	"SQRT":       unaryFunc((*Series).Sqrt, math.Sqrt),
+	"LOG":        unaryFunc((*Series).Log, math.Log),
+	"EXP":        unaryFunc((*Series).Exp, math.Exp),
+	"MIN":        binaryFunc(Min[*Series], math.Min),
+	"MAX":        binaryFunc(Max[*Series], math.Max),
+}
+
+/*
+ParseExpr parse a formula expression, return error wrapping ErrInvalidExpr for syntax errors,
+unknown functions or variables, and wrong argument counts.
+
+解析公式表达式，语法错误、未知函数或变量、参数数量错误时返回ErrInvalidExpr
+*/
+func ParseExpr(text string) (*Expr, error) {
+	tokens, err := lexExpr(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, exprErr(tok.pos, "unexpected %q", tok.text)
+	}
+	return &Expr{Text: text, root: root}, nil
+}
+
+func exprErr(pos int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w at %d: %s", ErrInvalidExpr, pos, fmt.Sprintf(format, args...))
+}
+
+/*
+Eval compute the expression on current bar of env, should be called on every bar like indicators.
+
+在env的当前bar上计算表达式，和指标一样需要每个bar调用
+*/
+func (x *Expr) Eval(e *BarEnv) *Series {
+	val := x.root.evalLive(e)
+	if val.ser == nil {
+		return constSeries(e, val.num)
+	}
+	return val.ser
+}
+
+/*
+EvalVec compute the expression on slices, data should contain lower case variable names used in expression,
+such as "close".
+
+基于切片计算表达式，data中需包含表达式用到的变量，如close
+*/
+func (x *Expr) EvalVec(data map[string][]float64) ([]float64, error) {
+	size := -1
+	for _, arr := range data {
+		if size >= 0 && len(arr) != size {
+			return nil, fmt.Errorf("%w: data length mismatch", ErrInvalidExpr)
+		}
+		size = len(arr)
+	}
+	val, err := x.root.evalVec(data)
+	if err != nil {
+		return nil, err
+	}
+	return toVec(val, max(size, 0)), nil
+}
+
+// constSeries return a Series with a constant value
+func constSeries(e *BarEnv, val float64) *Series {
+	return e.Close.calcUnary(Key("_const", val), func(v float64) float64 {
+		return val
+	})
+}
+
+func toVec(val exprVec, size int) []float64 {
+	if val.arr != nil {
+		return val.arr
+	}
+	res := make([]float64, size)
+	for i := range res {
+		res[i] = val.num
+	}
+	return res
+}
+
+func (n *exprNode) isConst() bool {
+	switch n.op {
+	case "num":
+		return true
+	case "var", "call":
+		return false
+	}
+	for _, a := range n.args {
+		if !a.isConst() {
+			return false
+		}
+	}
+	return true
+}
+
+// constVal compute value of a constant node
+func (n *exprNode) constVal() float64 {
+	switch n.op {
+	case "num":
+		return n.num
+	case "neg":
+		return -n.args[0].constVal()
+	case "not":
+		return opNot(n.args[0].constVal())
+	}
+	return exprOps[n.op](n.args[0].constVal(), n.args[1].constVal())
+}
+
+func (n *exprNode) evalLive(e *BarEnv) exprVal {
+	if n.isConst() {
+		return exprVal{num: n.constVal()}
+	}
+	switch n.op {
+	case "var":
+		return exprVal{ser: e.varSeries(n.name)}
+	case "neg":
+		return exprVal{ser: n.args[0].evalLive(e).series(e).Neg()}
+	case "not":
+		return exprVal{ser: n.args[0].evalLive(e).series(e).Not()}
+	case "call":
+		fn := n.fn
+		ins := make([]*Series, fn.series)
+		for i := range ins {
+			ins[i] = n.args[i].evalLive(e).series(e)
+		}
+		params := make([]float64, fn.params)
+		for i := range params {
+			params[i] = n.args[fn.series+i].constVal()
+		}
+		return exprVal{ser: fn.live(e, ins, params)}
+	}
+	a, b := n.args[0].evalLive(e), n.args[1].evalLive(e)
+	if b.ser != nil {
+		return exprVal{ser: binarySeries(n.op, a.series(e), b.ser)}
+	}
+	return exprVal{ser: binarySeries(n.op, a.series(e), b.num)}
+}
+
+func (v exprVal) series(e *BarEnv) *Series {
+	if v.ser == nil {
+		return constSeries(e, v.num)
+	}
+	return v.ser
+}
+
+// binarySeries apply binary operator on Series
+func binarySeries[T Operand](op string, s *Series, obj T) *Series {
+	switch op {
+	case "+":
+		return Add(s, obj)
+	case "-":
+		return Sub(s, obj)
+	case "*":
+		return Mul(s, obj)
+	case "/":
+		return Div(s, obj)
+	case "^":
+		return Pow(s, obj)
+	case ">":
+		return Greater(s, obj)
+	case "<":
+		return Less(s, obj)
+	case ">=":
+		return Less(s, obj).Not()
+	case "<=":
+		return Greater(s, obj).Not()
+	case "==":
+		return Equal(s, obj)
+	case "!=":
+		return Equal(s, obj).Not()
+	case "AND":
+		return And(s, obj)
+	case "OR":
+		return Or(s, obj)
+	}
+	panic(fmt.Errorf("%w: unknown operator %s", ErrInvalidExpr, op))
+}
+
+func (e *BarEnv) varSeries(name string) *Series {
+	switch name {
+	case "open":
+		return e.Open
+	case "high":
+		return e.High
+	case "low":
+		return e.Low
+	case "volume":
+		return e.Volume
+	case "info":
+		return e.Info
+	case "quote":
+		e.enableExt()
+		return e.QuoteVolume
+	case "trades":
+		e.enableExt()
+		return e.TradeNum
+	case "buy":
+		e.enableExt()
+		return e.BuyVolume
+	}
+	return e.Close
+}
+
+func (n *exprNode) evalVec(data map[string][]float64) (exprVec, error) {
+	if n.isConst() {
+		return exprVec{num: n.constVal()}, nil
+	}
+	switch n.op {
+	case "var":
+		arr, ok := data[n.name]
+		if !ok {
+			return exprVec{}, exprErr(n.pos, "missing data for %s", n.name)
+		}
+		return exprVec{arr: arr}, nil
+	case "neg", "not":
+		val, err := n.args[0].evalVec(data)
+		if err != nil {
+			return val, err
+		}
+		calc := opNot
+		if n.op == "neg" {
+			calc = func(v float64) float64 { return -v }
+		}
+		return exprVec{arr: mapVec(val.arr, calc)}, nil
+	}
+	args := make([]exprVec, len(n.args))
+	size := 0
+	for i, a := range n.args {
+		val, err := a.evalVec(data)
+		if err != nil {
+			return val, err
+		}
+		args[i] = val
+		size = max(size, len(val.arr))
+	}
+	if n.op == "call" {
+		fn := n.fn
+		ins := make([][]float64, fn.series)
+		for i := range ins {
+			ins[i] = toVec(args[i], size)
+		}
+		params := make([]float64, fn.params)
+		for i := range params {
+			params[i] = args[fn.series+i].num
+		}
+		return exprVec{arr: fn.vec(ins, params)}, nil
+	}
+	a, b := toVec(args[0], size), toVec(args[1], size)
+	calc := exprOps[n.op]
+	res := make([]float64, size)
+	for i := range res {
+		res[i] = calc(a[i], b[i])
+	}
+	return exprVec{arr: res}, nil
+}
+
+const (
+	tokEOF = iota
+	tokNum
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind int
+	text string
+	num  float64
+	pos  int
+}
+
+var exprSymbols = []string{">=", "<=", "==", "!=", "&&", "||", ">", "<", "+", "-", "*", "/", "^", "!", "(", ")", ","}
+
+func lexExpr(text string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		if unicode.IsSpace(c) {
+			i++
+			continue
+		}
+		start := i
+		if unicode.IsDigit(c) || c == '.' {
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' ||
+				runes[i] == 'e' || runes[i] == 'E' || ((runes[i] == '-' || runes[i] == '+') &&
+				(runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+				i++
+			}
+			word := string(runes[start:i])
+			num, err := strconv.ParseFloat(word, 64)
+			if err != nil {
+				return nil, exprErr(start, "invalid number %q", word)
+			}
+			tokens = append(tokens, exprToken{tokNum, word, num, start})
+			continue
+		}
+		if unicode.IsLetter(c) || c == '_' {
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			word := string(runes[start:i])
+			switch upper := strings.ToUpper(word); upper {
+			case "AND", "OR", "NOT":
+				tokens = append(tokens, exprToken{tokOp, upper, 0, start})
+			default:
+				tokens = append(tokens, exprToken{tokIdent, word, 0, start})
+			}
+			continue
+		}
+		matched := false
+		for _, sym := range exprSymbols {
+			if strings.HasPrefix(string(runes[i:]), sym) {
+				text := sym
+				switch sym {
+				case "&&":
+					text = "AND"
+				case "||":
+					text = "OR"
+				case "!":
+					text = "NOT"
+				}
+				tokens = append(tokens, exprToken{tokOp, text, 0, start})
+				i += len([]rune(sym))
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, exprErr(start, "unexpected character %q", string(c))
+		}
+	}
+	tokens = append(tokens, exprToken{kind: tokEOF, text: "EOF", pos: len(runes)})
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consume the next token if it's one of given operators
+func (p *exprParser) accept(ops ...string) (exprToken, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return tok, false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.pos++
+			return tok, true
+		}
+	}
+	return tok, false
+}
+
+// parseBinary parse left associative binary operators
+func (p *exprParser) parseBinary(sub func() (*exprNode, error), ops ...string) (*exprNode, error) {
+	left, err := sub()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := sub()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{op: tok.text, args: []*exprNode{left, right}, pos: tok.pos}
+	}
+}
+
+func (p *exprParser) parseOr() (*exprNode, error) {
+	return p.parseBinary(p.parseAnd, "OR")
+}
+
+func (p *exprParser) parseAnd() (*exprNode, error) {
+	return p.parseBinary(p.parseNot, "AND")
+}
+
+func (p *exprParser) parseNot() (*exprNode, error) {
+	if tok, ok := p.accept("NOT"); ok {
+		arg, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNode{op: "not", args: []*exprNode{arg}, pos: tok.pos}, nil
+	}
+	left, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.accept(">", "<", ">=", "<=", "==", "!="); ok {
+		right, err := p.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNode{op: tok.text, args: []*exprNode{left, right}, pos: tok.pos}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdd() (*exprNode, error) {
+	return p.parseBinary(p.parseMul, "+", "-")
+}
+
+func (p *exprParser) parseMul() (*exprNode, error) {
+	return p.parseBinary(p.parseUnary, "*", "/")
+}
+
+func (p *exprParser) parseUnary() (*exprNode, error) {
+	if tok, ok := p.accept("-"); ok {
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNode{op: "neg", args: []*exprNode{arg}, pos: tok.pos}, nil
+	}
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.accept("^"); ok {
+		// 右结合，-2^2 == -(2^2)
+		exp, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNode{op: "^", args: []*exprNode{base, exp}, pos: tok.pos}, nil
+	}
+	return base, nil
+}
+
+func (p *exprParser) parsePrimary() (*exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNum:
+		return &exprNode{op: "num", num: tok.num, pos: tok.pos}, nil
+	case tokIdent:
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(tok)
+		}
+		name := strings.ToLower(tok.text)
+		if !exprVars[name] {
+			return nil, exprErr(tok.pos, "unknown variable %s", tok.text)
+		}
+		return &exprNode{op: "var", name: name, pos: tok.pos}, nil
+	case tokOp:
+		if tok.text == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, exprErr(p.peek().pos, "missing )")
+			}
+			return node, nil
+		}
+	}
+	return nil, exprErr(tok.pos, "unexpected %q", tok.text)
+}
+
+func (p *exprParser) parseCall(tok exprToken) (*exprNode, error) {
+	name := strings.ToUpper(tok.text)
+	fn, ok := exprFuncs[name]
+	var ind *IndInfo
+	if !ok {
+		if ind = GetIndicator(name); ind == nil {
+			return nil, exprErr(tok.pos, "unknown function %s", tok.text)
+		}
+	}
+	node := &exprNode{op: "call", name: name, pos: tok.pos}
+	if ind != nil {
+		fn = indFunc(ind)
+		if ind.UseEnv {
+			// 读取BarEnv的指标只传参数，输入作为变量参与计算
+			for _, in := range ind.Inputs {
+				node.args = append(node.args, &exprNode{op: "var", name: in, pos: tok.pos})
+			}
+		}
+	}
+	node.fn = fn
+	userStart := len(node.args)
+	if _, ok = p.accept(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			node.args = append(node.args, arg)
+			if _, ok = p.accept(")"); ok {
+				break
+			}
+			if _, ok = p.accept(","); !ok {
+				return nil, exprErr(p.peek().pos, "expect , or ) in %s", tok.text)
+			}
+		}
+	}
+	if argNum := fn.series + fn.params; len(node.args) != argNum {
+		return nil, exprErr(tok.pos, "%s expects %d arguments, got %d", tok.text, argNum-userStart,
+			len(node.args)-userStart)
+	}
+	params := make([]float64, 0, fn.params)
+	for i, arg := range node.args[fn.series:] {
+		if !arg.isConst() {
+			return nil, exprErr(arg.pos, "argument %d of %s must be a number", fn.series-userStart+i+1, tok.text)
+		}
+		params = append(params, arg.constVal())
+	}
+	if ind != nil {
+		if _, err := ind.CheckArgs(params); err != nil {
+			return nil, exprErr(tok.pos, "%v", err)
+		}
+	}
+	return node, nil
+}
+
+// indFunc call an indicator in registry and use its first output
+func indFunc(ind *IndInfo) *exprFunc {
+	return &exprFunc{
+		series: len(ind.Inputs),
+		params: len(ind.Params),
+		live: func(e *BarEnv, ins []*Series, params []float64) *Series {
+			return ind.call(e, ins, params)[0]
+		},
+		vec: func(ins [][]float64, params []float64) []float64 {
+			return ind.callVec(ins, params)[0]
+		},
+	}
+}
@@ -0,0 +1,74 @@
+package banta
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/banbox/banta/tav"
+)
+
+func TestExpr(t *testing.T) {
+	o, h, l, c, v, i := extractOHLCV(DataKline)
+	data := map[string][]float64{"open": o, "high": h, "low": l, "close": c, "volume": v, "info": i}
+	exprs := []string{
+		"EMA(close,12)-EMA(close,26) > 0 AND RSI(close,14) < 30",
+		"ema(close, 12) - ema(close, 26) >= 0 or not rsi(close, 14) <= 50",
+		"(high + low) / 2 - SMA(close, 2 * 5)",
+		"-close ^ 2 / 1e6 + 100 - close",
+		"IIF(CROSSOVER(SMA(close,3), SMA(close,6)), close, 0) + CROSSUNDER(close, SMA(close, 5))",
+		"BARSSINCE(close > open) + VALUEWHEN(RISING(close, 2), low, 0)",
+		"ATR(high, low, close, 14) / close * 100 != MAX(ABS(CHANGE(close, 3)), 1)",
+		"MACD(close, 12, 26, 9) && !(volume == 0) || 2 > 3",
+		"3 * 4",
+		"WILLR(14) + ADL() / 1e6 - KDJBy(high, low, close, 9, 3, 3, 1)",
+	}
+	for _, text := range exprs {
+		x, err := ParseExpr(text)
+		if err != nil {
+			t.Fatalf("parse %s: %v", text, err)
+		}
+		expects, err := x.EvalVec(data)
+		if err != nil {
+			t.Fatalf("eval vec %s: %v", text, err)
+		}
+		env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+		RunFakeEnv(env, DataKline, func(j int, k Kline) {
+			val := x.Eval(env).Get(0)
+			if !equalNearly(val, expects[j]) {
+				t.Fatalf("%s bar %d: live %v, vec %v", text, j, val, expects[j])
+			}
+		})
+	}
+	// 和直接调用结果一致
+	x, _ := ParseExpr("EMA(close,12)-EMA(close,26)")
+	res, _ := x.EvalVec(data)
+	macd, _ := tav.MACD(c, 12, 26, 9)
+	for j := range res {
+		if !equalNearly(res[j], macd[j]) {
+			t.Fatalf("bar %d: expect %v, got %v", j, macd[j], res[j])
+		}
+	}
+
+	bads := []string{
+		"FOO(close, 3)",
+		"SMA(close)",
+		"SMA(close, 3, 4)",
+		"SMA(close, close)",
+		"closes + 1",
+		"close +",
+		"(close + 1",
+		"close # 2",
+		"SMA(close 3)",
+		"SMA(close, 0)",
+		"WILLR(close, 14)",
+	}
+	for _, text := range bads {
+		if _, err := ParseExpr(text); !errors.Is(err, ErrInvalidExpr) {
+			t.Errorf("expect ErrInvalidExpr for %s, got %v", text, err)
+		}
+	}
+	x, _ = ParseExpr("close + volume")
+	if _, err := x.EvalVec(map[string][]float64{"close": c}); !errors.Is(err, ErrInvalidExpr) {
+		t.Errorf("expect error for missing data, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package banta
+
+import "math"
+
+/*
+OnKline add a new finished bar with extended fields (QuoteVolume, TradeNum, BuyVolume), same as OnBar otherwise.
+The extended Series of BarEnv are created on the first call, and are NaN for bars added by OnBar.
+
+添加一个带扩展字段（成交额、成交笔数、主动买入量）的已完成K线，其他同OnBar。
+首次调用时创建BarEnv的扩展序列，通过OnBar添加的K线扩展字段为NaN
+*/
+func (e *BarEnv) OnKline(bar *Kline) error {
+	return e.onBar(bar.Time, bar.Open, bar.High, bar.Low, bar.Close, bar.Volume, bar.Info, bar)
+}
+
+/*
+OnKlineUpdate update the latest unfinished bar with extended fields, see OnBarUpdate
+
+使用带扩展字段的K线更新当前未完成的K线，见OnBarUpdate
+*/
+func (e *BarEnv) OnKlineUpdate(bar *Kline) error {
+	if e.Open == nil || bar.Time > e.TimeStart {
+		e.Intrabar = true
+		return e.OnKline(bar)
+	}
+	e.extBar = bar
+	defer func() {
+		e.extBar = nil
+	}()
+	return e.OnBarUpdate(bar.Time, bar.Open, bar.High, bar.Low, bar.Close, bar.Volume, bar.Info)
+}
+
+// extCols return extended Series, items are nil if not enabled
+func (e *BarEnv) extCols() []*Series {
+	return []*Series{e.QuoteVolume, e.TradeNum, e.BuyVolume}
+}
+
+// enableExt create extended Series if not exist, values of existing bars are NaN
+func (e *BarEnv) enableExt() {
+	e.lockExt.Lock()
+	defer e.lockExt.Unlock()
+	if e.QuoteVolume != nil {
+		return
+	}
+	size := 0
+	if e.Close != nil {
+		size = e.Close.Len()
+	}
+	cols := make([]*Series, 3)
+	for i := range cols {
+		data := make([]float64, size)
+		for j := range data {
+			data[j] = math.NaN()
+		}
+		cols[i] = e.NewSeries(data)
+	}
+	e.QuoteVolume, e.TradeNum, e.BuyVolume = cols[0], cols[1], cols[2]
+}
+
+// appendExt append extended fields of the new bar, which are set by OnKline
+func (e *BarEnv) appendExt() {
+	bar := e.extBar
+	e.extBar = nil
+	if bar != nil {
+		e.enableExt()
+	} else if e.QuoteVolume == nil {
+		return
+	}
+	vals := []float64{math.NaN(), math.NaN(), math.NaN()}
+	if bar != nil {
+		vals = []float64{bar.QuoteVolume, bar.TradeNum, bar.BuyVolume}
+	}
+	for i, s := range e.extCols() {
+		s.Time = e.TimeStart
+		s.Data = append(s.Data, vals[i])
+	}
+}
+
+// updateExt replace extended fields of the latest bar, which are set by OnKlineUpdate
+func (e *BarEnv) updateExt() {
+	bar := e.extBar
+	e.extBar = nil
+	if bar == nil {
+		return
+	}
+	e.enableExt()
+	e.QuoteVolume.setLast(bar.QuoteVolume)
+	e.TradeNum.setLast(bar.TradeNum)
+	e.BuyVolume.setLast(bar.BuyVolume)
+}
+
+// extVal return the latest value of extended Series, NaN if not enabled
+func extVal(s *Series) float64 {
+	if s == nil {
+		return math.NaN()
+	}
+	return s.Get(0)
+}
+
+// addNaN add b to a, NaN values are ignored
+func addNaN(a, b float64) float64 {
+	if math.IsNaN(b) {
+		return a
+	}
+	if math.IsNaN(a) {
+		return b
+	}
+	return a + b
+}
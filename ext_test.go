@@ -0,0 +1,114 @@
+package banta
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/banbox/banta/tav"
+)
+
+func TestOnKline(t *testing.T) {
+	klines := waveKlines(60)
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	env.GapPolicy = GapFill
+	k := klines[0]
+	// 普通K线，不创建扩展序列
+	_ = env.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+	if env.QuoteVolume != nil {
+		t.Fatal("expect no extended series before OnKline")
+	}
+	CVD(env)
+	var vols, quotes, trades, buys []float64
+	for j, k := range klines[1:] {
+		if j == 10 {
+			// 缺失一个bar，扩展字段填充0
+			continue
+		}
+		if err := env.OnKline(&k); err != nil {
+			t.Fatal(err)
+		}
+		CVD(env)
+	}
+	for j, k := range klines {
+		switch {
+		case j == 0:
+			vols, quotes, trades, buys = append(vols, k.Volume), append(quotes, math.NaN()),
+				append(trades, math.NaN()), append(buys, math.NaN())
+		case j == 11:
+			vols, quotes, trades, buys = append(vols, 0), append(quotes, 0), append(trades, 0), append(buys, 0)
+		default:
+			vols, quotes, trades, buys = append(vols, k.Volume), append(quotes, k.QuoteVolume),
+				append(trades, k.TradeNum), append(buys, k.BuyVolume)
+		}
+	}
+	if env.QuoteVolume.Len() != len(klines) || env.BuyVolume.Len() != env.Close.Len() {
+		t.Fatalf("expect %d extended values, got %d", len(klines), env.QuoteVolume.Len())
+	}
+	cols := [][]float64{quotes, trades, buys}
+	for i, s := range env.extCols() {
+		for j, exp := range cols[i] {
+			if val := s.Get(len(klines) - 1 - j); !equalNearly(val, exp) {
+				t.Fatalf("col %d bar %d: expect %v, got %v", i, j, exp, val)
+			}
+		}
+	}
+	cvd := tav.CVD(vols, buys)
+	if val := CVD(env).Get(0); !equalNearly(val, cvd[len(cvd)-1]) {
+		t.Errorf("expect cvd %v, got %v", cvd[len(cvd)-1], val)
+	}
+	last := klines[len(klines)-1]
+	if val := QVWAP(env, 1).Get(0); !equalNearly(val, last.QuoteVolume/last.Volume) {
+		t.Errorf("expect bar vwap %v, got %v", last.QuoteVolume/last.Volume, val)
+	}
+	ex, err := ParseExpr("AvgTradeSize(1) * trades - volume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val := ex.Eval(env).Get(0); !equalNearly(val, 0) {
+		t.Errorf("expect 0 from expression, got %v", val)
+	}
+	var buf bytes.Buffer
+	if err = env.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBarEnv(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.TradeNum == nil || loaded.TradeNum.Get(0) != last.TradeNum {
+		t.Errorf("expect extended series restored")
+	}
+	env.Reset()
+	if env.QuoteVolume != nil {
+		t.Errorf("expect extended series cleared by reset")
+	}
+}
+
+func TestKlineResample(t *testing.T) {
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1h")
+	env.Intrabar = true
+	h4, err := env.Resample("4h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := int64(1688169600000)
+	for i := 0; i < 8; i++ {
+		k := Kline{Time: start + int64(i)*3600000, Open: 1, High: 2, Low: 0.5, Close: 1.5, Volume: 10,
+			QuoteVolume: 15, TradeNum: 3, BuyVolume: 4}
+		if err = env.OnKline(&k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if h4.Close.Len() != 2 || h4.QuoteVolume.Get(0) != 60 || h4.TradeNum.Get(0) != 12 || h4.BuyVolume.Get(0) != 16 {
+		t.Fatalf("expect extended fields summed, got %v %v", h4.QuoteVolume.Data, h4.TradeNum.Data)
+	}
+	k := Kline{Time: start + 7*3600000, Open: 1, High: 2, Low: 0.5, Close: 1.5, Volume: 10,
+		QuoteVolume: 25, TradeNum: 5, BuyVolume: 6}
+	if err = env.OnKlineUpdate(&k); err != nil {
+		t.Fatal(err)
+	}
+	if env.QuoteVolume.Get(0) != 25 || h4.QuoteVolume.Get(0) != 70 || h4.TradeNum.Get(0) != 14 {
+		t.Errorf("expect updated extended fields, got %v, %v", env.QuoteVolume.Get(0), h4.QuoteVolume.Get(0))
+	}
+}
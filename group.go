@@ -0,0 +1,268 @@
+package banta
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+/*
+EnvGroup own many BarEnv keyed by exchange/market/symbol/timeframe, and process bars with a bounded worker pool.
+
+Bars of the same BarEnv are processed in order by one worker at a time, different BarEnv run concurrently.
+Callback is called in the worker after each bar, so it can compute indicators of the env safely.
+Bars are added by BarEnv.OnKline, so extended fields such as QuoteVolume are kept.
+
+管理多个BarEnv，键为exchange/market/symbol/timeframe，使用固定数量的协程处理K线。
+同一BarEnv的K线按顺序依次处理，不同BarEnv并发执行。每个bar处理后在工作协程中调用Callback，可在其中计算该env的指标。
+K线通过BarEnv.OnKline添加，保留QuoteVolume等扩展字段
+*/
+type EnvGroup struct {
+	Callback func(e *BarEnv, bar *Kline, err error) // err为BarEnv.OnKline返回的错误
+	envs     map[string]*groupEnv
+	ready    []*groupEnv   // 有待处理K线且未在执行的env
+	timeNum  map[int64]int // 各时间戳未完成的K线数量
+	lock     sync.Mutex
+	cond     *sync.Cond
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+type groupEnv struct {
+	env     *BarEnv
+	queue   []*groupTask
+	running bool
+}
+
+type groupTask struct {
+	bar   *Kline
+	batch *groupBatch
+}
+
+// groupBatch bars pushed together by OnBars
+type groupBatch struct {
+	wg   sync.WaitGroup
+	errs []error
+	lock sync.Mutex
+}
+
+/*
+NewEnvGroup create an EnvGroup with given number of workers, cb is called after each bar and can be nil
+
+创建EnvGroup，workers为工作协程数量，cb在每个bar处理后调用，可为空
+*/
+func NewEnvGroup(workers int, cb func(e *BarEnv, bar *Kline, err error)) *EnvGroup {
+	g := &EnvGroup{
+		Callback: cb,
+		envs:     make(map[string]*groupEnv),
+		timeNum:  make(map[int64]int),
+	}
+	g.cond = sync.NewCond(&g.lock)
+	for i := 0; i < max(workers, 1); i++ {
+		g.wg.Add(1)
+		go g.work()
+	}
+	return g
+}
+
+// EnvKey return the key of BarEnv in EnvGroup, same as BarEnv.String
+func EnvKey(exgName, market, symbol, timeframe string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", exgName, market, symbol, timeframe)
+}
+
+/*
+Env return the BarEnv for given key, create it if not exist
+
+返回对应的BarEnv，不存在时创建
+*/
+func (g *EnvGroup) Env(exgName, market, symbol, timeframe string) (*BarEnv, error) {
+	key := EnvKey(exgName, market, symbol, timeframe)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if ge, ok := g.envs[key]; ok {
+		return ge.env, nil
+	}
+	env, err := NewBarEnv(exgName, market, symbol, timeframe)
+	if err != nil {
+		return nil, err
+	}
+	g.envs[key] = &groupEnv{env: env}
+	return env, nil
+}
+
+// Add add a created BarEnv to group, replace the existing one with the same key which has no pending bars
+func (g *EnvGroup) Add(env *BarEnv) error {
+	key := env.String()
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if ge, ok := g.envs[key]; ok && (ge.running || len(ge.queue) > 0) {
+		return fmt.Errorf("%w: %s is busy", ErrEnvGroup, key)
+	}
+	g.envs[key] = &groupEnv{env: env}
+	return nil
+}
+
+// Remove remove BarEnv from group, pending bars of it are still processed
+func (g *EnvGroup) Remove(key string) {
+	g.lock.Lock()
+	delete(g.envs, key)
+	g.lock.Unlock()
+}
+
+// Get return the BarEnv for key, nil if not found
+func (g *EnvGroup) Get(key string) *BarEnv {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if ge, ok := g.envs[key]; ok {
+		return ge.env
+	}
+	return nil
+}
+
+// Keys return keys of all BarEnv in group, sorted
+func (g *EnvGroup) Keys() []string {
+	g.lock.Lock()
+	keys := make([]string, 0, len(g.envs))
+	for k := range g.envs {
+		keys = append(keys, k)
+	}
+	g.lock.Unlock()
+	slices.Sort(keys)
+	return keys
+}
+
+/*
+Push add a bar of the BarEnv with key to queue and return immediately. Use WaitTime to wait for it.
+
+将key对应BarEnv的K线加入队列后立即返回，可使用WaitTime等待完成
+*/
+func (g *EnvGroup) Push(key string, bar *Kline) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.push(key, &groupTask{bar: bar})
+}
+
+func (g *EnvGroup) push(key string, task *groupTask) error {
+	if g.closed {
+		return fmt.Errorf("%w: closed", ErrEnvGroup)
+	}
+	ge, ok := g.envs[key]
+	if !ok {
+		return fmt.Errorf("%w: unknown env %s", ErrEnvGroup, key)
+	}
+	ge.queue = append(ge.queue, task)
+	g.timeNum[task.bar.Time] += 1
+	if !ge.running {
+		ge.running = true
+		g.ready = append(g.ready, ge)
+		g.cond.Broadcast()
+	}
+	return nil
+}
+
+/*
+OnBars process bars of the same timestamp for many BarEnv and wait until all are done, as a barrier.
+bars is keyed by EnvKey. Return joined errors of unknown keys and BarEnv.OnKline.
+
+处理多个BarEnv同一时间的K线并等待全部完成（屏障）。bars的键为EnvKey。返回未知键和BarEnv.OnKline的错误
+*/
+func (g *EnvGroup) OnBars(bars map[string]*Kline) error {
+	batch := &groupBatch{}
+	g.lock.Lock()
+	for key, bar := range bars {
+		batch.wg.Add(1)
+		if err := g.push(key, &groupTask{bar: bar, batch: batch}); err != nil {
+			batch.wg.Done()
+			batch.lock.Lock()
+			batch.errs = append(batch.errs, err)
+			batch.lock.Unlock()
+		}
+	}
+	g.lock.Unlock()
+	batch.wg.Wait()
+	return errors.Join(batch.errs...)
+}
+
+/*
+WaitTime wait until all pushed bars whose time <= barMS are done
+
+等待所有已加入的时间<=barMS的K线处理完成
+*/
+func (g *EnvGroup) WaitTime(barMS int64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for g.hasPending(barMS) {
+		g.cond.Wait()
+	}
+}
+
+func (g *EnvGroup) hasPending(barMS int64) bool {
+	for t := range g.timeNum {
+		if t <= barMS {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Close stop workers after all pending bars are done, Push after Close returns error
+
+处理完所有待处理K线后停止工作协程，之后Push返回错误
+*/
+func (g *EnvGroup) Close() {
+	g.lock.Lock()
+	g.closed = true
+	g.cond.Broadcast()
+	g.lock.Unlock()
+	g.wg.Wait()
+}
+
+func (g *EnvGroup) work() {
+	defer g.wg.Done()
+	g.lock.Lock()
+	for {
+		for len(g.ready) == 0 && !g.closed {
+			g.cond.Wait()
+		}
+		if len(g.ready) == 0 {
+			g.lock.Unlock()
+			return
+		}
+		ge := g.ready[0]
+		g.ready = g.ready[1:]
+		task := ge.queue[0]
+		ge.queue = ge.queue[1:]
+		g.lock.Unlock()
+
+		bar := task.bar
+		err := ge.env.OnKline(bar)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", ge.env.String(), err)
+		}
+		if g.Callback != nil {
+			g.Callback(ge.env, bar, err)
+		}
+		if batch := task.batch; batch != nil {
+			if err != nil {
+				batch.lock.Lock()
+				batch.errs = append(batch.errs, err)
+				batch.lock.Unlock()
+			}
+			batch.wg.Done()
+		}
+
+		g.lock.Lock()
+		if len(ge.queue) > 0 {
+			// 放到队尾，其他env也能轮到
+			g.ready = append(g.ready, ge)
+		} else {
+			ge.running = false
+		}
+		if g.timeNum[bar.Time] -= 1; g.timeNum[bar.Time] <= 0 {
+			delete(g.timeNum, bar.Time)
+		}
+		g.cond.Broadcast()
+	}
+}
@@ -0,0 +1,133 @@
+package banta
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/banbox/banta/tav"
+)
+
+func TestEnvGroup(t *testing.T) {
+	_, _, _, c, _, _ := extractOHLCV(DataKline)
+	expects := tav.EMA(c, 10)
+	var running, maxRunning atomic.Int32
+	var lock sync.Mutex
+	results := make(map[string][]float64)
+	g := NewEnvGroup(4, func(e *BarEnv, bar *Kline, err error) {
+		num := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := maxRunning.Load()
+			if num <= old || maxRunning.CompareAndSwap(old, num) {
+				break
+			}
+		}
+		if err != nil {
+			return
+		}
+		val := EMA(e.Close, 10).Get(0)
+		lock.Lock()
+		results[e.String()] = append(results[e.String()], val)
+		lock.Unlock()
+	})
+	var keys []string
+	for i := 0; i < 20; i++ {
+		env, err := g.Env("binance", "spot", fmt.Sprintf("C%d/USDT", i), "1d")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, env.String())
+	}
+	if env, _ := g.Env("binance", "spot", "C0/USDT", "1d"); env != g.Get(keys[0]) {
+		t.Error("expect same env for same key")
+	}
+	// 前半部分用屏障逐个时间处理
+	half := len(DataKline) / 2
+	for _, k := range DataKline[:half] {
+		bars := make(map[string]*Kline)
+		for _, key := range keys {
+			bars[key] = &k
+		}
+		if err := g.OnBars(bars); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range keys {
+			if env := g.Get(key); env.TimeStart != k.Time {
+				t.Fatalf("%s: expect bar %d done, got %d", key, k.Time, env.TimeStart)
+			}
+		}
+	}
+	// 后半部分异步推送
+	for _, key := range keys {
+		for i := half; i < len(DataKline); i++ {
+			if err := g.Push(key, &DataKline[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	g.WaitTime(DataKline[len(DataKline)-1].Time)
+	if maxRunning.Load() > 4 {
+		t.Errorf("expect at most 4 workers, got %d", maxRunning.Load())
+	}
+	for _, key := range keys {
+		vals := results[key]
+		if len(vals) != len(expects) {
+			t.Fatalf("%s: expect %d bars, got %d", key, len(expects), len(vals))
+		}
+		for i, v := range vals {
+			if !equalNearly(v, expects[i]) {
+				t.Fatalf("%s bar %d: expect %v, got %v", key, i, expects[i], v)
+			}
+		}
+	}
+	// 旧K线和未知键返回错误
+	err := g.OnBars(map[string]*Kline{keys[0]: &DataKline[0], "binance/spot/FOO/1d": &DataKline[0]})
+	if !errors.Is(err, ErrEnvGroup) || !strings.Contains(err.Error(), "old Bar") {
+		t.Errorf("expect errors, got %v", err)
+	}
+	g.Close()
+	if err = g.Push(keys[0], &DataKline[0]); !errors.Is(err, ErrEnvGroup) {
+		t.Errorf("expect error after close, got %v", err)
+	}
+}
+
+func TestEnvGroupExt(t *testing.T) {
+	klines := waveKlines(50)
+	ref, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	var results, expects [][]float64
+	calc := func(e *BarEnv) []float64 {
+		return []float64{CVD(e).Get(0), QVWAP(e, 5).Get(0), AvgTradeSize(e, 5).Get(0)}
+	}
+	g := NewEnvGroup(2, func(e *BarEnv, bar *Kline, err error) {
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		results = append(results, calc(e))
+	})
+	defer g.Close()
+	env, _ := g.Env("binance", "spot", "BTC/USDT", "1d")
+	for i := range klines {
+		if err := g.OnBars(map[string]*Kline{env.String(): &klines[i]}); err != nil {
+			t.Fatal(err)
+		}
+		_ = ref.OnKline(&klines[i])
+		expects = append(expects, calc(ref))
+	}
+	last := results[len(results)-1]
+	if len(results) != len(klines) || math.IsNaN(last[0]) || math.IsNaN(last[1]) || math.IsNaN(last[2]) {
+		t.Fatalf("expect extended indicators computed, got %v", last)
+	}
+	for i, vals := range results {
+		for j, v := range vals {
+			if !equalNearly(v, expects[i][j]) {
+				t.Fatalf("bar %d ind %d: expect %v, got %v", i, j, expects[i][j], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package banta
+
+import (
+	"slices"
+	"sync"
+)
+
+// policies when the channel of Series.Watch is full
+const (
+	WatchBlock   = iota // 阻塞Append直到消费者读取
+	WatchDropNew        // 丢弃新值
+	WatchDropOld        // 丢弃最旧的值，保留最新的
+)
+
+// SeriesVal a value appended to Series
+type SeriesVal struct {
+	Time int64     // 所属bar的结束时间，同Series.Time
+	Vals []float64 // 主值及各Cols的值
+}
+
+type seriesHook struct {
+	cb func(v SeriesVal)
+}
+
+/*
+OnAppend register a callback fired after Append writes a new value (with values of Cols) to s,
+return a function to unsubscribe, which can be called multiple times, also inside callback.
+
+Callbacks run in the goroutine calling the indicator, while LockData of s is held:
+they should return quickly and must not Append or Set s. Use Watch for slow consumers.
+After OnBarUpdate, the value of current bar is appended again with the same Time.
+OHLCV, extended and auxiliary Series of BarEnv fire in OnBar and OnBarUpdate, before indicators are computed.
+
+注册回调，Append写入新值（含Cols的值）后触发，返回取消函数，可多次调用，也可在回调中调用。
+回调在计算指标的协程中执行，此时持有s的LockData：应尽快返回，不可对s调用Append或Set；慢速消费者请使用Watch。
+OnBarUpdate后当前bar的值会以相同的Time再次触发。
+BarEnv的OHLCV、扩展和辅助序列在OnBar和OnBarUpdate中、计算指标之前触发
+*/
+func (s *Series) OnAppend(cb func(v SeriesVal)) func() {
+	hook := &seriesHook{cb: cb}
+	s.lockHooks.Lock()
+	s.hooks = append(s.hooks, hook)
+	s.lockHooks.Unlock()
+	return func() {
+		s.lockHooks.Lock()
+		s.hooks = slices.DeleteFunc(s.hooks, func(h *seriesHook) bool {
+			return h == hook
+		})
+		s.lockHooks.Unlock()
+	}
+}
+
+/*
+Watch return a channel receiving values appended to s, with buffer size and policy when full:
+WatchBlock, WatchDropNew or WatchDropOld. WatchBlock blocks the indicator calculation (holding LockData of s)
+until the value is received or the watch is cancelled.
+The returned function cancels watching and closes the channel.
+
+返回接收s新增值的通道，size为缓冲大小，policy为通道满时的处理方式。
+WatchBlock会阻塞指标计算（持有s的LockData）直到值被读取或取消。返回的函数取消监听并关闭通道
+*/
+func (s *Series) Watch(size int, policy int) (<-chan SeriesVal, func()) {
+	if policy != WatchBlock {
+		// 丢弃策略需要缓冲
+		size = max(size, 1)
+	}
+	ch := make(chan SeriesVal, max(size, 0))
+	done := make(chan struct{})
+	var lock sync.Mutex
+	closed := false
+	unsub := s.OnAppend(func(v SeriesVal) {
+		lock.Lock()
+		defer lock.Unlock()
+		if closed {
+			return
+		}
+		switch policy {
+		case WatchDropNew:
+			select {
+			case ch <- v:
+			default:
+			}
+		case WatchDropOld:
+			for {
+				select {
+				case ch <- v:
+					return
+				default:
+				}
+				select {
+				case <-ch:
+				default:
+				}
+			}
+		default:
+			select {
+			case ch <- v:
+			case <-done:
+			}
+		}
+	})
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			unsub()
+			// 先唤醒阻塞的发送，再关闭通道
+			close(done)
+			lock.Lock()
+			closed = true
+			close(ch)
+			lock.Unlock()
+		})
+	}
+}
+
+// fireRootHooks call hooks of ohlcv, extended and auxiliary Series, which are written without Append
+func (e *BarEnv) fireRootHooks() {
+	roots := e.roots()
+	if e.QuoteVolume != nil {
+		roots = append(roots, e.extCols()...)
+	}
+	e.lockAux.Lock()
+	for _, in := range e.aux {
+		roots = append(roots, in.ser)
+	}
+	e.lockAux.Unlock()
+	for _, s := range roots {
+		// 根序列的Time为bar开始时间，回调中统一使用结束时间
+		s.fireHooks(e.TimeStop)
+	}
+}
+
+// fireHooks call hooks with the latest value of s and its Cols, time is the end of current bar
+func (s *Series) fireHooks(time int64) {
+	s.lockHooks.Lock()
+	hooks := slices.Clone(s.hooks)
+	s.lockHooks.Unlock()
+	if len(hooks) == 0 {
+		return
+	}
+	vals := make([]float64, 0, len(s.Cols)+1)
+	vals = append(vals, s.Get(0))
+	for _, col := range s.Cols {
+		vals = append(vals, col.Get(0))
+	}
+	for _, h := range hooks {
+		h.cb(SeriesVal{Time: time, Vals: vals})
+	}
+}
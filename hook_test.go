@@ -0,0 +1,154 @@
+package banta
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/banbox/banta/tav"
+)
+
+func TestOnAppend(t *testing.T) {
+	_, _, _, c, _, _ := extractOHLCV(DataKline)
+	sma := tav.SMA(c, 5)
+	std, mean := tav.StdDevBy(c, 5, 0)
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	var smaVals, stdVals []SeriesVal
+	var unsubs []func()
+	onceNum := 0
+	RunFakeEnv(env, DataKline, func(i int, k Kline) {
+		res := SMA(env.Close, 5)
+		sd, _ := StdDevBy(env.Close, 5, 0)
+		if i == 0 {
+			// 从第二个bar开始接收
+			unsubs = append(unsubs, res.OnAppend(func(v SeriesVal) {
+				smaVals = append(smaVals, v)
+			}))
+			unsubs = append(unsubs, sd.OnAppend(func(v SeriesVal) {
+				stdVals = append(stdVals, v)
+			}))
+			var unsub func()
+			unsub = res.OnAppend(func(v SeriesVal) {
+				onceNum += 1
+				unsub()
+			})
+		} else if i == len(DataKline)-10 {
+			for _, unsub := range unsubs {
+				unsub()
+				unsub()
+			}
+		}
+	})
+	if onceNum != 1 {
+		t.Errorf("expect callback once, got %d", onceNum)
+	}
+	expNum := len(DataKline) - 10
+	if len(smaVals) != expNum || len(stdVals) != expNum {
+		t.Fatalf("expect %d values, got %d, %d", expNum, len(smaVals), len(stdVals))
+	}
+	for i, v := range smaVals {
+		j := i + 1
+		if v.Time != DataKline[j].Time+env.TFMSecs || !equalNearly(v.Vals[0], sma[j]) {
+			t.Fatalf("sma %d: expect %v, got %v", j, sma[j], v)
+		}
+		v2 := stdVals[i]
+		if len(v2.Vals) != 2 || !equalNearly(v2.Vals[0], std[j]) || !equalNearly(v2.Vals[1], mean[j]) {
+			t.Fatalf("stddev %d: expect %v %v, got %v", j, std[j], mean[j], v2.Vals)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	_, _, _, c, _, _ := extractOHLCV(DataKline)
+	sma := tav.SMA(c, 5)
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	k := DataKline[0]
+	env.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+	res := SMA(env.Close, 5)
+	oldCh, stopOld := res.Watch(2, WatchDropOld)
+	newCh, stopNew := res.Watch(2, WatchDropNew)
+	blockCh, stopBlock := res.Watch(0, WatchBlock)
+	var got []float64
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for v := range blockCh {
+			got = append(got, v.Vals[0])
+		}
+	}()
+	for _, k = range DataKline[1:] {
+		env.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		SMA(env.Close, 5)
+	}
+	stopBlock()
+	stopBlock()
+	wg.Wait()
+	if len(got) != len(DataKline)-1 {
+		t.Fatalf("block: expect %d values, got %d", len(DataKline)-1, len(got))
+	}
+	for i, v := range got {
+		if !equalNearly(v, sma[i+1]) {
+			t.Fatalf("block %d: expect %v, got %v", i+1, sma[i+1], v)
+		}
+	}
+	stopOld()
+	stopNew()
+	var olds, news []float64
+	for v := range oldCh {
+		olds = append(olds, v.Vals[0])
+	}
+	for v := range newCh {
+		news = append(news, v.Vals[0])
+	}
+	last := len(sma) - 1
+	if len(olds) != 2 || !equalNearly(olds[0], sma[last-1]) || !equalNearly(olds[1], sma[last]) {
+		t.Errorf("drop old: expect latest 2 values, got %v", olds)
+	}
+	if len(news) != 2 || !equalNearly(news[0], sma[1]) || !equalNearly(news[1], sma[2]) {
+		t.Errorf("drop new: expect first 2 values, got %v", news)
+	}
+}
+
+func TestRootHooks(t *testing.T) {
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	var funds []SeriesVal
+	env.Aux("fund").OnAppend(func(v SeriesVal) {
+		funds = append(funds, v)
+	})
+	klines := DataKline[:5]
+	k := klines[0]
+	_ = env.OnKline(&k)
+	var closes, quotes []SeriesVal
+	env.Close.OnAppend(func(v SeriesVal) {
+		closes = append(closes, v)
+	})
+	env.QuoteVolume.OnAppend(func(v SeriesVal) {
+		quotes = append(quotes, v)
+	})
+	for i, k := range klines[1:] {
+		k.QuoteVolume = float64(i + 1)
+		env.FeedAux("fund", k.Time, float64(i))
+		_ = env.OnKline(&k)
+	}
+	if len(funds) != len(klines) || funds[len(funds)-1].Vals[0] != 3 {
+		t.Fatalf("expect %d aux values, got %v", len(klines), funds)
+	}
+	if len(closes) != len(klines)-1 || len(quotes) != len(closes) {
+		t.Fatalf("expect %d close values, got %d, %d", len(klines)-1, len(closes), len(quotes))
+	}
+	for i, v := range closes {
+		k := klines[i+1]
+		if v.Time != k.Time+env.TFMSecs || v.Vals[0] != k.Close || quotes[i].Vals[0] != float64(i+1) {
+			t.Fatalf("close %d: expect %v, got %v", i, k.Close, v)
+		}
+	}
+	// OnBarUpdate以相同的Time再次触发
+	env.Intrabar = true
+	k = DataKline[5]
+	_ = env.OnBarUpdate(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+	_ = env.OnBarUpdate(k.Time, k.Open, k.High, k.Low, k.Close+1, k.Volume, k.Info)
+	num := len(closes)
+	if num != len(klines)+1 || closes[num-1].Time != closes[num-2].Time || closes[num-1].Vals[0] != k.Close+1 {
+		t.Errorf("expect close updated, got %v", closes[num-2:])
+	}
+}
@@ -0,0 +1,288 @@
+package banta
+
+import (
+	"fmt"
+	"math"
+)
+
+/*
+Operand types which can be used together with a Series, checked at compile time.
+
+可以和Series一起计算的类型，编译时检查
+*/
+type Operand interface {
+	*Series | int | int64 | float32 | float64
+}
+
+// anyVal return current value of obj, panic with ErrInvalidSeriesVal for unsupported types
+func anyVal(obj interface{}) float64 {
+	switch v := obj.(type) {
+	case *Series:
+		return v.Get(0)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	}
+	panic(fmt.Errorf("%w: %T", ErrInvalidSeriesVal, obj))
+}
+
+func opAdd(a, b float64) float64 { return a + b }
+func opSub(a, b float64) float64 { return a - b }
+func opMul(a, b float64) float64 { return a * b }
+func opDiv(a, b float64) float64 { return a / b }
+
+// calcOp derive a Series from s and obj, result is always a sub Series of s keyed by obj
+func (s *Series) calcOp(rel string, obj interface{}, val float64, calc func(a, b float64) float64) *Series {
+	res := s.ToKey(Key(rel, obj))
+	if res.Cached() {
+		return res
+	}
+	res.LockData.Lock()
+	if !res.Cached() {
+		res.Append(calc(s.Get(0), val))
+	}
+	res.LockData.Unlock()
+	return res
+}
+
+/*
+Add return s + obj, obj can be a Series or a number
+
+返回s + obj，obj可以是Series或数字
+*/
+func Add[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_add", obj, anyVal(obj), opAdd)
+}
+
+// Sub return s - obj
+func Sub[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_sub", obj, anyVal(obj), opSub)
+}
+
+// Mul return s * obj
+func Mul[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_mul", obj, anyVal(obj), opMul)
+}
+
+// Div return s / obj
+func Div[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_div", obj, anyVal(obj), opDiv)
+}
+
+// Min return the smaller one of s and obj
+func Min[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_min", obj, anyVal(obj), math.Min)
+}
+
+// Max return the larger one of s and obj
+func Max[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_max", obj, anyVal(obj), math.Max)
+}
+
+/*
+CrossOf same as Series.Cross, return the distance of the latest cross between s and obj.
+positive for cross over, negative for cross under, 0 for unknown.
+
+计算s和obj最近一次交叉的距离。正数上穿，负数下穿，0表示未知
+*/
+func CrossOf[T Operand](s *Series, obj T) int {
+	return s.crossVal(keyArg(obj), anyVal(obj))
+}
+
+func boolVal(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// compareOp wrap a comparison to return 0/1, NaN if any input is NaN
+func compareOp(cmp func(a, b float64) bool) func(a, b float64) float64 {
+	return func(a, b float64) float64 {
+		if math.IsNaN(a) || math.IsNaN(b) {
+			return math.NaN()
+		}
+		return boolVal(cmp(a, b))
+	}
+}
+
+var (
+	opGreater = compareOp(func(a, b float64) bool { return a > b })
+	opLess    = compareOp(func(a, b float64) bool { return a < b })
+	opEqual   = compareOp(func(a, b float64) bool { return a == b })
+	opAnd     = compareOp(func(a, b float64) bool { return a != 0 && b != 0 })
+	opOr      = compareOp(func(a, b float64) bool { return a != 0 || b != 0 })
+)
+
+// Pow return s ** obj
+func Pow[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_pow", obj, anyVal(obj), math.Pow)
+}
+
+/*
+Greater return 1 if s > obj, else 0; NaN if any of them is NaN
+
+s > obj时为1，否则为0；任一为NaN时返回NaN
+*/
+func Greater[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_gt", obj, anyVal(obj), opGreater)
+}
+
+// Less return 1 if s < obj, else 0; NaN if any of them is NaN
+func Less[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_lt", obj, anyVal(obj), opLess)
+}
+
+// Equal return 1 if s == obj (exactly), else 0; NaN if any of them is NaN
+func Equal[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_eq", obj, anyVal(obj), opEqual)
+}
+
+// And return 1 if both s and obj are non-zero, else 0; NaN if any of them is NaN
+func And[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_and", obj, anyVal(obj), opAnd)
+}
+
+// Or return 1 if any of s and obj is non-zero, else 0; NaN if any of them is NaN
+func Or[T Operand](s *Series, obj T) *Series {
+	return s.calcOp("_or", obj, anyVal(obj), opOr)
+}
+
+/*
+IIf return a when cond is non-zero, else b; NaN when cond is NaN. The result is a sub Series of cond.
+
+cond非0时取a，否则取b；cond为NaN时返回NaN
+*/
+func IIf[A, B Operand](cond *Series, a A, b B) *Series {
+	res := cond.ToKey(Key("_iif", a, b))
+	if res.Cached() {
+		return res
+	}
+	res.LockData.Lock()
+	if !res.Cached() {
+		flag := cond.Get(0)
+		if math.IsNaN(flag) {
+			res.Append(math.NaN())
+		} else if flag != 0 {
+			res.Append(anyVal(a))
+		} else {
+			res.Append(anyVal(b))
+		}
+	}
+	res.LockData.Unlock()
+	return res
+}
+
+// calcUnary derive a Series from s with a function of current value
+func (s *Series) calcUnary(key ParamKey, calc func(v float64) float64) *Series {
+	res := s.ToKey(key)
+	if res.Cached() {
+		return res
+	}
+	res.LockData.Lock()
+	if !res.Cached() {
+		res.Append(calc(s.Get(0)))
+	}
+	res.LockData.Unlock()
+	return res
+}
+
+// Pow same as Pow[T]
+func (s *Series) Pow(obj interface{}) *Series {
+	return s.calcOp("_pow", obj, anyVal(obj), math.Pow)
+}
+
+// Greater same as Greater[T]
+func (s *Series) Greater(obj interface{}) *Series {
+	return s.calcOp("_gt", obj, anyVal(obj), opGreater)
+}
+
+// Less same as Less[T]
+func (s *Series) Less(obj interface{}) *Series {
+	return s.calcOp("_lt", obj, anyVal(obj), opLess)
+}
+
+// Equal same as Equal[T]
+func (s *Series) Equal(obj interface{}) *Series {
+	return s.calcOp("_eq", obj, anyVal(obj), opEqual)
+}
+
+// And same as And[T]
+func (s *Series) And(obj interface{}) *Series {
+	return s.calcOp("_and", obj, anyVal(obj), opAnd)
+}
+
+// Or same as Or[T]
+func (s *Series) Or(obj interface{}) *Series {
+	return s.calcOp("_or", obj, anyVal(obj), opOr)
+}
+
+// Not return 1 if s is 0, else 0; NaN keeps NaN
+func (s *Series) Not() *Series {
+	return s.calcUnary(Key("_not"), func(v float64) float64 {
+		if math.IsNaN(v) {
+			return v
+		}
+		return boolVal(v == 0)
+	})
+}
+
+func (s *Series) Sqrt() *Series {
+	return s.calcUnary(Key("_sqrt"), math.Sqrt)
+}
+
+// Log natural logarithm
+func (s *Series) Log() *Series {
+	return s.calcUnary(Key("_log"), math.Log)
+}
+
+func (s *Series) Exp() *Series {
+	return s.calcUnary(Key("_exp"), math.Exp)
+}
+
+func (s *Series) Neg() *Series {
+	return s.calcUnary(Key("_neg"), func(v float64) float64 {
+		return -v
+	})
+}
+
+// Sign return 1 for positive, -1 for negative, 0 for zero, NaN keeps NaN
+func (s *Series) Sign() *Series {
+	return s.calcUnary(Key("_sign"), func(v float64) float64 {
+		if v > 0 {
+			return 1
+		} else if v < 0 {
+			return -1
+		}
+		return v
+	})
+}
+
+/*
+Round round half away from zero to given decimal digits, digits can be negative
+
+四舍五入到指定小数位数，digits可为负数
+*/
+func (s *Series) Round(digits int) *Series {
+	scale := math.Pow10(digits)
+	return s.calcUnary(Key("_round", digits), func(v float64) float64 {
+		return math.Round(v*scale) / scale
+	})
+}
+
+// Clamp limit value in [low, high], NaN keeps NaN
+func (s *Series) Clamp(low, high float64) *Series {
+	return s.calcUnary(Key("_clamp", low, high), func(v float64) float64 {
+		if v < low {
+			return low
+		} else if v > high {
+			return high
+		}
+		return v
+	})
+}
@@ -0,0 +1,759 @@
+package banta
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+/*
+Binary layout of BarEnv.Dump, all numbers are little endian:
+
+	magic "BNTA", version uint16
+	env fields, gap/intrabar/evict settings, timezone/session offset/week anchor, ids of ohlcv and extended Series
+	auxiliary series: name, ID, last aligned value, pending values
+	Series list: ID, Time, Data, Cols, Subs, XLogs, More, snapshot for OnBarUpdate
+*/
+
+const (
+	dumpMagic   = "BNTA"
+	dumpVersion = 6
+)
+
+var (
+	ErrInvalidDump = errors.New("invalid BarEnv dump data")
+)
+
+// moreState is the indicator state stored in Series.More, which can be cloned and saved
+type moreState interface {
+	clone() moreState
+	kind() string
+	dump(w *binWriter)
+	load(r *binReader)
+}
+
+// moreKinds create empty state by kind, used by LoadBarEnv
+var moreKinds = map[string]func() moreState{
+	"sum":  func() moreState { return &sumState{} },
+	"vwma": func() moreState { return &moreVWMA{} },
+	"wma":  func() moreState { return &wmaSta{} },
+	"dm":   func() moreState { return &dmState{} },
+	"tnr":  func() moreState { return &tnrState{} },
+	"cmf":  func() moreState { return &cmfState{} },
+	"mfi":  func() moreState { return &mfiState{} },
+	"cmo":  func() moreState { return &cmdSta{} },
+	"dv2":  func() moreState { return &dv2Sta{} },
+	"stc":  func() moreState { return &stcSta{} },
+}
+
+const (
+	moreKindNone  = ""
+	moreKindFloat = "f64"
+	moreKindArr   = "arr"
+)
+
+func dupMoreState(more interface{}) interface{} {
+	return more.(moreState).clone()
+}
+
+func dupFloatArr(more interface{}) interface{} {
+	return append([]float64{}, more.([]float64)...)
+}
+
+/*
+Dump save BarEnv with all Series and their indicator states to w. Load it by LoadBarEnv.
+GapPolicy, GapNum, Intrabar, EvictIdle and snapshots of the current bar are saved, so OnBarUpdate works after loading.
+
+BarEnv.Data, OnGapBar, subscriptions, listeners and hooks are not saved.
+
+保存BarEnv及所有Series和指标状态，可通过LoadBarEnv恢复。GapPolicy、GapNum、Intrabar、EvictIdle和当前bar的快照会保存，
+加载后可继续OnBarUpdate。不包含BarEnv.Data、OnGapBar、订阅、监听和回调
+*/
+func (e *BarEnv) Dump(w io.Writer) error {
+	bw := &binWriter{w: bufio.NewWriter(w)}
+	bw.raw([]byte(dumpMagic))
+	bw.u16(dumpVersion)
+	bw.str(e.Exchange)
+	bw.str(e.MarketType)
+	bw.str(e.Symbol)
+	bw.str(e.TimeFrame)
+	bw.i64(e.TimeStart)
+	bw.i64(e.TimeStop)
+	bw.i64(e.TFMSecs)
+	bw.int(e.BarNum)
+	bw.int(e.MaxCache)
+	bw.int(e.VNum)
+	bw.int(e.GapPolicy)
+	bw.int(e.GapNum)
+	bw.int(e.EvictIdle)
+	bw.bool(e.Intrabar)
+	bw.i64(e.snapBar)
+	dumpFrame(bw, e.Frame, e.TimeStart)
+	for _, s := range append(e.roots(), e.extCols()...) {
+		bw.int(seriesID(s))
+	}
+	e.dumpAux(bw)
+	e.LockItems.RLock()
+	items := make([]*Series, 0, len(e.Items))
+	for _, s := range e.Items {
+		items = append(items, s)
+	}
+	e.LockItems.RUnlock()
+	slices.SortFunc(items, func(a, b *Series) int {
+		return a.ID - b.ID
+	})
+	bw.int(len(items))
+	for _, s := range items {
+		if err := s.dump(bw); err != nil {
+			return err
+		}
+	}
+	if bw.err != nil {
+		return bw.err
+	}
+	return bw.w.Flush()
+}
+
+/*
+LoadBarEnv restore a BarEnv saved by BarEnv.Dump, indicators continue from the saved states.
+
+从BarEnv.Dump的数据恢复BarEnv，指标从保存的状态继续计算
+*/
+func LoadBarEnv(r io.Reader) (*BarEnv, error) {
+	br := &binReader{r: bufio.NewReader(r)}
+	magic := br.raw(len(dumpMagic))
+	if br.err != nil || string(magic) != dumpMagic {
+		return nil, ErrInvalidDump
+	}
+	ver := br.u16()
+	if ver != dumpVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidDump, ver)
+	}
+	e, err := NewBarEnv(br.str(), br.str(), br.str(), br.str())
+	if br.err != nil {
+		return nil, br.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.TimeStart = br.i64()
+	e.TimeStop = br.i64()
+	e.TFMSecs = br.i64()
+	e.BarNum = br.int()
+	e.MaxCache = br.int()
+	e.VNum = br.int()
+	e.GapPolicy = br.int()
+	e.GapNum = br.int()
+	e.EvictIdle = br.int()
+	e.Intrabar = br.bool()
+	e.snapBar = br.i64()
+	if err = loadFrame(br, e.Frame); err != nil {
+		return nil, err
+	}
+	rootIds := make([]int, 9)
+	for i := range rootIds {
+		rootIds[i] = br.int()
+	}
+	auxIds := loadAux(br)
+	num := br.size()
+	if br.err != nil {
+		return nil, br.err
+	}
+	links := make([]*seriesLinks, 0, num)
+	for i := 0; i < num; i++ {
+		s, link := loadSeries(e, br)
+		if br.err != nil {
+			return nil, br.err
+		}
+		e.Items[s.ID] = s
+		links = append(links, link)
+	}
+	for _, link := range links {
+		if err = link.apply(e); err != nil {
+			return nil, err
+		}
+	}
+	roots := []**Series{&e.Open, &e.High, &e.Low, &e.Close, &e.Volume, &e.Info,
+		&e.QuoteVolume, &e.TradeNum, &e.BuyVolume}
+	for i, id := range rootIds {
+		if id < 0 {
+			continue
+		}
+		s, ok := e.Items[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing series %d", ErrInvalidDump, id)
+		}
+		*roots[i] = s
+	}
+	if len(auxIds) > 0 {
+		e.aux = make(map[string]*auxInput, len(auxIds))
+	}
+	for name, in := range auxIds {
+		s, ok := e.Items[in.ser.ID]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing aux series %d", ErrInvalidDump, in.ser.ID)
+		}
+		s.auxName = name
+		in.ser = s
+		e.aux[name] = in
+	}
+	return e, nil
+}
+
+// dumpAux save names, Series ids, last aligned values and pending values of auxiliary series
+func (e *BarEnv) dumpAux(w *binWriter) {
+	e.lockAux.Lock()
+	defer e.lockAux.Unlock()
+	w.int(len(e.aux))
+	for _, name := range slices.Sorted(maps.Keys(e.aux)) {
+		in := e.aux[name]
+		w.str(name)
+		w.int(in.ser.ID)
+		w.f64(in.last)
+		w.int(len(in.pend))
+		for _, v := range in.pend {
+			w.i64(v.time)
+			w.f64(v.val)
+		}
+	}
+}
+
+// loadAux read auxiliary inputs saved by dumpAux, ser only carries the ID before Series are loaded
+func loadAux(r *binReader) map[string]*auxInput {
+	num := r.size()
+	res := make(map[string]*auxInput, num)
+	for i := 0; i < num && r.err == nil; i++ {
+		name := r.str()
+		in := &auxInput{ser: &Series{ID: r.int()}, last: r.f64()}
+		pendNum := r.size()
+		for j := 0; j < pendNum && r.err == nil; j++ {
+			in.pend = append(in.pend, auxVal{time: r.i64(), val: r.f64()})
+		}
+		res[name] = in
+	}
+	return res
+}
+
+func seriesID(s *Series) int {
+	if s == nil {
+		return -1
+	}
+	return s.ID
+}
+
+// dumpFrame save timezone, session offset and week anchor of timeframe
+func dumpFrame(w *binWriter, t *TFrame, ms int64) {
+	if t == nil {
+		t = &TFrame{WeekStart: time.Monday}
+	}
+	loc := t.loc()
+	_, zoneSecs := time.UnixMilli(ms).In(loc).Zone()
+	w.str(loc.String())
+	w.int(zoneSecs)
+	w.i64(t.Offset)
+	w.int(int(t.WeekStart))
+}
+
+func loadFrame(r *binReader, t *TFrame) error {
+	name, zoneSecs := r.str(), r.int()
+	t.Offset = r.i64()
+	t.WeekStart = time.Weekday(r.int())
+	if r.err != nil {
+		return r.err
+	}
+	if name == "UTC" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		// 无法加载的时区（如FixedZone）使用保存的固定偏移
+		loc = time.FixedZone(name, zoneSecs)
+	}
+	t.Loc = loc
+	return nil
+}
+
+func (s *Series) dump(w *binWriter) error {
+	s.LockData.RLock()
+	defer s.LockData.RUnlock()
+	w.int(s.ID)
+	w.i64(s.Time)
+	w.f64s(s.Data)
+	w.int(len(s.Cols))
+	for _, c := range s.Cols {
+		w.int(c.ID)
+	}
+	s.LockSub.Lock()
+	w.int(len(s.Subs))
+	for fn, sub := range s.Subs {
+		w.str(fn)
+		w.int(len(sub))
+		for k, v := range sub {
+			w.str(k)
+			w.int(v.ID)
+		}
+	}
+	s.LockSub.Unlock()
+	s.LockXLogs.Lock()
+	w.int(len(s.XLogs))
+	for k, v := range s.XLogs {
+		w.str(k)
+		w.i64(v.Time)
+		w.f64(v.PrevVal)
+		w.int(len(v.Hist))
+		for _, h := range v.Hist {
+			w.int(h.Sign)
+			w.int(h.BarNum)
+		}
+	}
+	s.LockXLogs.Unlock()
+	if err := dumpMore(w, s.More, s.ID); err != nil {
+		return err
+	}
+	snap := s.snap
+	w.bool(snap != nil)
+	if snap == nil {
+		return nil
+	}
+	w.i64(snap.time)
+	w.int(snap.dataLen)
+	w.int(len(snap.xlogs))
+	for k, v := range snap.xlogs {
+		w.str(k)
+		w.i64(v.time)
+		w.f64(v.prevVal)
+		w.int(v.histLen)
+	}
+	return dumpMore(w, snap.more, s.ID)
+}
+
+// dumpMore save indicator state of Series.More or its snapshot
+func dumpMore(w *binWriter, more interface{}, id int) error {
+	switch m := more.(type) {
+	case nil:
+		w.str(moreKindNone)
+	case float64:
+		w.str(moreKindFloat)
+		w.f64(m)
+	case []float64:
+		w.str(moreKindArr)
+		w.f64s(m)
+	case moreState:
+		w.str(m.kind())
+		m.dump(w)
+	default:
+		return fmt.Errorf("unsupported Series.More %T for dump, series: %d", more, id)
+	}
+	return nil
+}
+
+// loadMore read indicator state saved by dumpMore, return the state and its DupMore
+func loadMore(r *binReader) (interface{}, func(interface{}) interface{}) {
+	kind := r.str()
+	switch kind {
+	case moreKindNone:
+	case moreKindFloat:
+		return r.f64(), nil
+	case moreKindArr:
+		return r.f64s(), dupFloatArr
+	default:
+		create, ok := moreKinds[kind]
+		if !ok {
+			r.fail(fmt.Errorf("%w: unknown state %s", ErrInvalidDump, kind))
+			break
+		}
+		sta := create()
+		sta.load(r)
+		return sta, dupMoreState
+	}
+	return nil, nil
+}
+
+// seriesLinks hold ids of related Series, which are resolved after all Series loaded
+type seriesLinks struct {
+	s    *Series
+	cols []int
+	subs map[string]map[string]int
+}
+
+func loadSeries(e *BarEnv, r *binReader) (*Series, *seriesLinks) {
+	id := r.int()
+	res := e.newSeries(nil, nil, nil, nil, nil, nil)
+	res.ID = id
+	res.Time = r.i64()
+	res.Data = r.f64s()
+	link := &seriesLinks{s: res, subs: make(map[string]map[string]int)}
+	colNum := r.size()
+	for i := 0; i < colNum && r.err == nil; i++ {
+		link.cols = append(link.cols, r.int())
+	}
+	subNum := r.size()
+	for i := 0; i < subNum && r.err == nil; i++ {
+		fn := r.str()
+		num := r.size()
+		ids := make(map[string]int, num)
+		for j := 0; j < num && r.err == nil; j++ {
+			k := r.str()
+			ids[k] = r.int()
+		}
+		link.subs[fn] = ids
+	}
+	logNum := r.size()
+	for i := 0; i < logNum && r.err == nil; i++ {
+		k := r.str()
+		log := &CrossLog{Time: r.i64(), PrevVal: r.f64()}
+		histNum := r.size()
+		log.Hist = make([]*XState, 0, histNum)
+		for j := 0; j < histNum && r.err == nil; j++ {
+			log.Hist = append(log.Hist, &XState{Sign: r.int(), BarNum: r.int()})
+		}
+		res.XLogs[k] = log
+	}
+	res.More, res.DupMore = loadMore(r)
+	if !r.bool() {
+		return res, link
+	}
+	snap := &seriesSnap{time: r.i64(), dataLen: r.int()}
+	snapNum := r.size()
+	if snapNum > 0 {
+		snap.xlogs = make(map[string]xlogSnap, snapNum)
+	}
+	for i := 0; i < snapNum && r.err == nil; i++ {
+		k := r.str()
+		snap.xlogs[k] = xlogSnap{time: r.i64(), prevVal: r.f64(), histLen: r.int()}
+	}
+	var dupMore func(interface{}) interface{}
+	snap.more, dupMore = loadMore(r)
+	if res.DupMore == nil {
+		res.DupMore = dupMore
+	}
+	res.snap = snap
+	return res, link
+}
+
+func (l *seriesLinks) apply(e *BarEnv) error {
+	get := func(id int) (*Series, error) {
+		s, ok := e.Items[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing series %d", ErrInvalidDump, id)
+		}
+		return s, nil
+	}
+	for _, id := range l.cols {
+		col, err := get(id)
+		if err != nil {
+			return err
+		}
+		l.s.Cols = append(l.s.Cols, col)
+	}
+	for fn, ids := range l.subs {
+		sub := make(map[string]*Series, len(ids))
+		for k, id := range ids {
+			v, err := get(id)
+			if err != nil {
+				return err
+			}
+			sub[k] = v
+		}
+		l.s.Subs[fn] = sub
+	}
+	return nil
+}
+
+func (s *sumState) kind() string { return "sum" }
+
+func (s *sumState) dump(w *binWriter) {
+	w.f64(s.sumVal)
+	w.f64s(s.arr)
+}
+
+func (s *sumState) load(r *binReader) {
+	s.sumVal = r.f64()
+	s.arr = r.f64s()
+}
+
+func (m *moreVWMA) kind() string { return "vwma" }
+
+func (m *moreVWMA) dump(w *binWriter) {
+	w.f64(m.sumCost)
+	w.f64(m.sumWei)
+	w.f64s(m.costs)
+	w.f64s(m.volumes)
+}
+
+func (m *moreVWMA) load(r *binReader) {
+	m.sumCost = r.f64()
+	m.sumWei = r.f64()
+	m.costs = r.f64s()
+	m.volumes = r.f64s()
+}
+
+func (m *wmaSta) kind() string { return "wma" }
+
+func (m *wmaSta) dump(w *binWriter) {
+	w.f64s(m.arr)
+	w.f64(m.allSum)
+	w.f64(m.weiSum)
+}
+
+func (m *wmaSta) load(r *binReader) {
+	m.arr = r.f64s()
+	m.allSum = r.f64()
+	m.weiSum = r.f64()
+}
+
+func (m *dmState) kind() string { return "dm" }
+
+func (m *dmState) dump(w *binWriter) {
+	w.int(m.Num)
+	w.f64(m.DmPosMA)
+	w.f64(m.DmNegMA)
+	w.f64(m.TRMA)
+}
+
+func (m *dmState) load(r *binReader) {
+	m.Num = r.int()
+	m.DmPosMA = r.f64()
+	m.DmNegMA = r.f64()
+	m.TRMA = r.f64()
+}
+
+func (m *tnrState) kind() string { return "tnr" }
+
+func (m *tnrState) dump(w *binWriter) {
+	w.f64s(m.arr)
+	w.f64(m.sumVal)
+	w.f64(m.prevIn)
+	w.f64s(m.arrIn)
+}
+
+func (m *tnrState) load(r *binReader) {
+	m.arr = r.f64s()
+	m.sumVal = r.f64()
+	m.prevIn = r.f64()
+	m.arrIn = r.f64s()
+}
+
+func (m *cmfState) kind() string { return "cmf" }
+
+func (m *cmfState) dump(w *binWriter) {
+	w.f64s(m.mfSum)
+	w.f64s(m.volSum)
+	w.f64(m.sumMfVal)
+	w.f64(m.sumVol)
+}
+
+func (m *cmfState) load(r *binReader) {
+	m.mfSum = r.f64s()
+	m.volSum = r.f64s()
+	m.sumMfVal = r.f64()
+	m.sumVol = r.f64()
+}
+
+func (m *mfiState) kind() string { return "mfi" }
+
+func (m *mfiState) dump(w *binWriter) {
+	w.f64s(m.posArr)
+	w.f64s(m.negArr)
+	w.f64(m.sumPos)
+	w.f64(m.sumNeg)
+	w.f64(m.prev)
+}
+
+func (m *mfiState) load(r *binReader) {
+	m.posArr = r.f64s()
+	m.negArr = r.f64s()
+	m.sumPos = r.f64()
+	m.sumNeg = r.f64()
+	m.prev = r.f64()
+}
+
+func (m *cmdSta) kind() string { return "cmo" }
+
+func (m *cmdSta) dump(w *binWriter) {
+	w.f64s(m.subs)
+	w.f64(m.sumPos)
+	w.f64(m.sumNeg)
+	w.f64(m.prevIn)
+}
+
+func (m *cmdSta) load(r *binReader) {
+	m.subs = r.f64s()
+	m.sumPos = r.f64()
+	m.sumNeg = r.f64()
+	m.prevIn = r.f64()
+}
+
+func (m *dv2Sta) kind() string { return "dv2" }
+
+func (m *dv2Sta) dump(w *binWriter) {
+	w.f64s(m.chl)
+	w.f64s(m.dv)
+}
+
+func (m *dv2Sta) load(r *binReader) {
+	m.chl = r.f64s()
+	m.dv = r.f64s()
+}
+
+func (m *stcSta) kind() string { return "stc" }
+
+func (m *stcSta) dump(w *binWriter) {
+	w.f64s(m.macdHis)
+	w.f64s(m.dddHis)
+	w.f64(m.prevDDD)
+	w.f64(m.prevSTC)
+}
+
+func (m *stcSta) load(r *binReader) {
+	m.macdHis = r.f64s()
+	m.dddHis = r.f64s()
+	m.prevDDD = r.f64()
+	m.prevSTC = r.f64()
+}
+
+type binWriter struct {
+	w   *bufio.Writer
+	buf [8]byte
+	err error
+}
+
+func (w *binWriter) raw(b []byte) {
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
+
+func (w *binWriter) u16(v uint16) {
+	binary.LittleEndian.PutUint16(w.buf[:2], v)
+	w.raw(w.buf[:2])
+}
+
+func (w *binWriter) i64(v int64) {
+	binary.LittleEndian.PutUint64(w.buf[:], uint64(v))
+	w.raw(w.buf[:])
+}
+
+func (w *binWriter) int(v int) {
+	w.i64(int64(v))
+}
+
+func (w *binWriter) f64(v float64) {
+	binary.LittleEndian.PutUint64(w.buf[:], math.Float64bits(v))
+	w.raw(w.buf[:])
+}
+
+func (w *binWriter) f64s(arr []float64) {
+	w.int(len(arr))
+	for _, v := range arr {
+		w.f64(v)
+	}
+}
+
+func (w *binWriter) str(v string) {
+	w.int(len(v))
+	w.raw([]byte(v))
+}
+
+func (w *binWriter) bool(v bool) {
+	if v {
+		w.raw([]byte{1})
+	} else {
+		w.raw([]byte{0})
+	}
+}
+
+type binReader struct {
+	r   *bufio.Reader
+	buf [8]byte
+	err error
+}
+
+func (r *binReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *binReader) raw(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	res := make([]byte, n)
+	if _, err := io.ReadFull(r.r, res); err != nil {
+		r.fail(err)
+		return nil
+	}
+	return res
+}
+
+func (r *binReader) u16() uint16 {
+	if r.err != nil {
+		return 0
+	}
+	if _, err := io.ReadFull(r.r, r.buf[:2]); err != nil {
+		r.fail(err)
+		return 0
+	}
+	return binary.LittleEndian.Uint16(r.buf[:2])
+}
+
+func (r *binReader) u64() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if _, err := io.ReadFull(r.r, r.buf[:]); err != nil {
+		r.fail(err)
+		return 0
+	}
+	return binary.LittleEndian.Uint64(r.buf[:])
+}
+
+func (r *binReader) i64() int64 {
+	return int64(r.u64())
+}
+
+func (r *binReader) int() int {
+	return int(r.u64())
+}
+
+func (r *binReader) f64() float64 {
+	return math.Float64frombits(r.u64())
+}
+
+// size read a length prefix, reject negative or huge values from broken data
+func (r *binReader) size() int {
+	n := r.int()
+	if n < 0 || n > 1<<28 {
+		r.fail(ErrInvalidDump)
+		return 0
+	}
+	return n
+}
+
+func (r *binReader) f64s() []float64 {
+	n := r.size()
+	if r.err != nil || n == 0 {
+		return nil
+	}
+	res := make([]float64, n)
+	for i := range res {
+		res[i] = r.f64()
+	}
+	return res
+}
+
+func (r *binReader) str() string {
+	return string(r.raw(r.size()))
+}
+
+func (r *binReader) bool() bool {
+	b := r.raw(1)
+	return len(b) == 1 && b[0] != 0
+}
@@ -0,0 +1,176 @@
+package banta
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDumpLoadBarEnv(t *testing.T) {
+	calcInds := func(e *BarEnv) []float64 {
+		k, d, _ := KDJ(e.High, e.Low, e.Close, 9, 3, 3)
+		up, _, lo := BBANDS(e.Close, 20, 2, 2)
+		return []float64{
+			SMA(e.Close, 5).Get(0),
+			EMA(e.Close, 10).Get(0),
+			VWMA(e.Close, e.Volume, 10).Get(0),
+			WMA(e.Close, 9).Get(0),
+			RSI(e.Close, 14).Get(0),
+			k.Get(0),
+			d.Get(0),
+			up.Get(0),
+			lo.Get(0),
+			ADX(e.High, e.Low, e.Close, 14).Get(0),
+			ROC(e.Close, 9).Get(0),
+			KAMA(e.Close, 10).Get(0),
+			CMF(e, 20).Get(0),
+			MFI(e, 14).Get(0),
+			CMO(e.Close, 9).Get(0),
+			DV2(e.High, e.Low, e.Close, 20, 2).Get(0),
+			STC(e.Close, 12, 26, 50, 0.5).Get(0),
+			float64(e.Close.Cross(EMA(e.Close, 10))),
+		}
+	}
+	stream, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	half := len(DataKline) / 2
+	for _, k := range DataKline[:half] {
+		_ = stream.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		calcInds(stream)
+	}
+	var buf bytes.Buffer
+	if err := stream.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBarEnv(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Symbol != stream.Symbol || loaded.BarNum != stream.BarNum || loaded.Close.Len() != stream.Close.Len() {
+		t.Fatalf("loaded env mismatch: %s %d %d", loaded.Symbol, loaded.BarNum, loaded.Close.Len())
+	}
+	for i, k := range DataKline[half:] {
+		_ = stream.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		_ = loaded.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		expects := calcInds(stream)
+		results := calcInds(loaded)
+		for j, v := range results {
+			if !equalNearly(v, expects[j]) {
+				t.Fatalf("bar %d ind %d: expect %v, got %v", half+i, j, expects[j], v)
+			}
+		}
+	}
+	if _, err = LoadBarEnv(bytes.NewReader([]byte("bad data"))); err == nil {
+		t.Error("expect error for invalid data")
+	}
+}
+
+func TestDumpLoadAux(t *testing.T) {
+	feed := func(e *BarEnv, i int) {
+		// 提前一个bar输入，保存时有待对齐的值
+		k := DataKline[i+1]
+		e.FeedAux("fund", k.Time+1000, float64(i%7))
+	}
+	calc := func(e *BarEnv) []float64 {
+		fund := e.Aux("fund")
+		return []float64{fund.Get(0), SMA(fund, 3).Get(0), EMA(fund, 5).Get(0)}
+	}
+	stream, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	half := len(DataKline) / 2
+	for i, k := range DataKline[:half] {
+		feed(stream, i)
+		_ = stream.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		calc(stream)
+	}
+	var buf bytes.Buffer
+	if err := stream.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBarEnv(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := loaded.AuxNames(); len(names) != 1 || names[0] != "fund" {
+		t.Fatalf("expect aux names restored, got %v", names)
+	}
+	fund := loaded.Aux("fund")
+	if loaded.Items[fund.ID] != fund || !loaded.isRoot(fund) || fund.Len() != stream.Aux("fund").Len() {
+		t.Fatalf("aux series not restored: %d", fund.ID)
+	}
+	for i := half; i < len(DataKline)-1; i++ {
+		k := DataKline[i]
+		for _, e := range []*BarEnv{stream, loaded} {
+			feed(e, i)
+			_ = e.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		}
+		loaded.Evict(1)
+		expects, results := calc(stream), calc(loaded)
+		for j, v := range results {
+			if !equalNearly(v, expects[j]) {
+				t.Fatalf("bar %d aux %d: expect %v, got %v", i, j, expects[j], v)
+			}
+		}
+	}
+}
+
+func TestDumpLoadIntrabar(t *testing.T) {
+	calc := func(e *BarEnv) []float64 {
+		k, _, _ := KDJ(e.High, e.Low, e.Close, 9, 3, 3)
+		return []float64{SMA(e.Close, 5).Get(0), EMA(e.Close, 10).Get(0), RSI(e.Close, 14).Get(0),
+			k.Get(0), float64(e.Close.Cross(EMA(e.Close, 10)))}
+	}
+	tick := func(e *BarEnv, k Kline, final bool) {
+		price := k.Open
+		if final {
+			price = k.Close
+		}
+		if err := e.OnBarUpdate(k.Time, k.Open, max(k.Open, price), min(k.Open, price), price, k.Volume, k.Info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第10个K线缺失
+	klines := append(append([]Kline{}, DataKline[:10]...), DataKline[11:]...)
+	stream, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	stream.GapPolicy = GapFill
+	stream.EvictIdle = 50
+	half := len(klines) / 2
+	for i, k := range klines[:half] {
+		tick(stream, k, false)
+		calc(stream)
+		if i < half-1 {
+			tick(stream, k, true)
+			calc(stream)
+		}
+	}
+	// 在K线中间保存
+	var buf bytes.Buffer
+	if err := stream.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBarEnv(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Intrabar || loaded.GapPolicy != GapFill || loaded.GapNum != 1 || loaded.EvictIdle != 50 {
+		t.Fatalf("env settings not restored: %v %d %d %d", loaded.Intrabar, loaded.GapPolicy, loaded.GapNum,
+			loaded.EvictIdle)
+	}
+	check := func(i int) {
+		expects, results := calc(stream), calc(loaded)
+		for j, v := range results {
+			if !equalNearly(v, expects[j]) {
+				t.Fatalf("bar %d ind %d: expect %v, got %v", i, j, expects[j], v)
+			}
+		}
+	}
+	for _, e := range []*BarEnv{stream, loaded} {
+		tick(e, klines[half-1], true)
+	}
+	check(half - 1)
+	for i := half; i < len(klines); i++ {
+		for _, final := range []bool{false, true} {
+			for _, e := range []*BarEnv{stream, loaded} {
+				tick(e, klines[i], final)
+			}
+			check(i)
+		}
+	}
+}
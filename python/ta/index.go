@@ -214,6 +214,18 @@ func ChaikinOsc(env *BarEnv, sml int, big int) Series {
 	return *banta.ChaikinOsc(env, sml, big)
 }
 
+func CVD(env *BarEnv) Series {
+	return *banta.CVD(env)
+}
+
+func QVWAP(env *BarEnv, period int) Series {
+	return *banta.QVWAP(env, period)
+}
+
+func AvgTradeSize(env *BarEnv, period int) Series {
+	return *banta.AvgTradeSize(env, period)
+}
+
 func KAMA(obj *Series, period int) Series {
 	return *banta.KAMA(obj, period)
 }
@@ -282,3 +294,23 @@ func UTBot(c, atr *Series, rate float64) Series {
 func STC(obj *Series, period, fast, slow int, alpha float64) Series {
 	return *banta.STC(obj, period, fast, slow, alpha)
 }
+
+func BarsSince(cond *Series) Series {
+	return *banta.BarsSince(cond)
+}
+
+func ValueWhen(cond, src *Series, occurrence int) Series {
+	return *banta.ValueWhen(cond, src, occurrence)
+}
+
+func Rising(obj *Series, period int) Series {
+	return *banta.Rising(obj, period)
+}
+
+func Falling(obj *Series, period int) Series {
+	return *banta.Falling(obj, period)
+}
+
+func Change(obj *Series, period int) Series {
+	return *banta.Change(obj, period)
+}
@@ -235,6 +235,21 @@ func CMF(high, low, close, volume []float64, period int) []float64 {
 	return banta_tav.CMF(high, low, close, volume, period)
 }
 
+// CVD calculates the Cumulative Volume Delta.
+func CVD(volume, buyVolume []float64) []float64 {
+	return banta_tav.CVD(volume, buyVolume)
+}
+
+// QVWAP calculates the Volume Weighted Average Price by quote volume.
+func QVWAP(quoteVolume, volume []float64, period int) []float64 {
+	return banta_tav.QVWAP(quoteVolume, volume, period)
+}
+
+// AvgTradeSize calculates the average volume per trade.
+func AvgTradeSize(volume, tradeNum []float64, period int) []float64 {
+	return banta_tav.AvgTradeSize(volume, tradeNum, period)
+}
+
 // KAMA calculates the Kaufman's Adaptive Moving Average.
 func KAMA(data []float64, period int) []float64 {
 	return banta_tav.KAMA(data, period)
@@ -329,6 +344,31 @@ func HeikinAshi(open, high, low, close []float64) [4][]float64 {
 	return [4][]float64{haOpen, haHigh, haLow, haClose}
 }
 
+// BarsSince calculates the number of bars since cond was non-zero.
+func BarsSince(cond []float64) []float64 {
+	return banta_tav.BarsSince(cond)
+}
+
+// ValueWhen returns the value of src when cond was non-zero.
+func ValueWhen(cond, src []float64, occurrence int) []float64 {
+	return banta_tav.ValueWhen(cond, src, occurrence)
+}
+
+// Rising checks whether data is greater than each of the previous period values.
+func Rising(data []float64, period int) []float64 {
+	return banta_tav.Rising(data, period)
+}
+
+// Falling checks whether data is less than each of the previous period values.
+func Falling(data []float64, period int) []float64 {
+	return banta_tav.Falling(data, period)
+}
+
+// Change calculates the difference from the value period bars ago.
+func Change(data []float64, period int) []float64 {
+	return banta_tav.Change(data, period)
+}
+
 // Cross detects crossovers between two data series.
 func Cross(data1 []float64, data2 []float64) []int {
 	return banta_tav.Cross(data1, data2)
@@ -0,0 +1,968 @@
+package banta
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/banbox/banta/tav"
+)
+
+// types of indicator parameters
+const (
+	ParamInt   = iota // 整数
+	ParamFloat        // 浮点数
+	ParamBool         // 布尔值，0为false，非0为true
+	ParamEnum         // 枚举，值为Options中的索引
+)
+
+// IndParam parameter of an indicator, values are always passed as float64
+type IndParam struct {
+	Name    string
+	Type    int
+	Default float64
+	Min     float64  // 包含，无限制时为-Inf
+	Max     float64  // 包含，无限制时为+Inf
+	Options []string // ParamEnum的可选值
+}
+
+/*
+IndInfo describe an indicator in registry: inputs, parameters, outputs and warm-up length,
+can be called by name with both stateful and vectorized implementations.
+
+Inputs are names of input series. For indicators with UseEnv, the inputs are read from BarEnv directly.
+
+指标的描述信息：输入、参数、输出和预热长度，可通过名称动态调用实时和向量版本
+*/
+type IndInfo struct {
+	Name    string
+	Inputs  []string // 输入序列名，open/high/low/close/volume/info/quote/trades/buy未传入时取自BarEnv
+	UseEnv  bool     // 参数为*BarEnv，直接读取Inputs对应的字段
+	Params  []*IndParam
+	Outputs []string // 输出列名，第一个是指标返回的主序列
+	warmUp  func(p []float64) int
+	call    func(e *BarEnv, ins []*Series, p []float64) []*Series
+	callVec func(ins [][]float64, p []float64) [][]float64
+}
+
+var indRegistry = make(map[string]*IndInfo)
+
+/*
+GetIndicator return the registered indicator by case-insensitive name, nil if not found
+
+按名称（不区分大小写）获取注册的指标，不存在时返回nil
+*/
+func GetIndicator(name string) *IndInfo {
+	return indRegistry[strings.ToUpper(name)]
+}
+
+// Indicators return all registered indicators sorted by name
+func Indicators() []*IndInfo {
+	res := make([]*IndInfo, 0, len(indRegistry))
+	for _, ind := range indRegistry {
+		res = append(res, ind)
+	}
+	slices.SortFunc(res, func(a, b *IndInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return res
+}
+
+func regInd(ind *IndInfo) {
+	key := strings.ToUpper(ind.Name)
+	if _, ok := indRegistry[key]; ok {
+		panic("duplicate indicator: " + ind.Name)
+	}
+	indRegistry[key] = ind
+}
+
+/*
+CheckArgs validate parameter values, missing trailing values are filled with defaults.
+
+校验参数值，缺少的末尾参数使用默认值填充
+*/
+func (i *IndInfo) CheckArgs(params []float64) ([]float64, error) {
+	if len(params) > len(i.Params) {
+		return nil, fmt.Errorf("%w: %s expects at most %d params, got %d", ErrInvalidIndArgs, i.Name,
+			len(i.Params), len(params))
+	}
+	res := make([]float64, len(i.Params))
+	for j, p := range i.Params {
+		if j >= len(params) {
+			res[j] = p.Default
+			continue
+		}
+		val := params[j]
+		if math.IsNaN(val) && p.Type == ParamFloat && math.IsNaN(p.Default) {
+			// 默认值为NaN的浮点参数允许NaN
+			res[j] = val
+			continue
+		}
+		if math.IsNaN(val) || val < p.Min || val > p.Max {
+			return nil, fmt.Errorf("%w: %s.%s should be in [%v, %v], got %v", ErrInvalidIndArgs, i.Name,
+				p.Name, p.Min, p.Max, val)
+		}
+		if p.Type != ParamFloat && val != math.Trunc(val) {
+			return nil, fmt.Errorf("%w: %s.%s should be integer, got %v", ErrInvalidIndArgs, i.Name, p.Name, val)
+		}
+		res[j] = val
+	}
+	return res, nil
+}
+
+/*
+ParseArgs convert named parameters from config files or UIs to values, missing ones use defaults.
+Values can be numbers, bool, or option names for ParamEnum.
+
+将配置文件或界面中的命名参数转为参数值，缺少的使用默认值。值可以是数字、bool，枚举可使用选项名
+*/
+func (i *IndInfo) ParseArgs(args map[string]interface{}) ([]float64, error) {
+	res := make([]float64, len(i.Params))
+	used := 0
+	for j, p := range i.Params {
+		res[j] = p.Default
+		val, ok := args[p.Name]
+		if !ok {
+			continue
+		}
+		used += 1
+		switch v := val.(type) {
+		case int:
+			res[j] = float64(v)
+		case int64:
+			res[j] = float64(v)
+		case float32:
+			res[j] = float64(v)
+		case float64:
+			res[j] = v
+		case bool:
+			res[j] = boolVal(v)
+		case string:
+			idx := slices.Index(p.Options, v)
+			if idx < 0 {
+				return nil, fmt.Errorf("%w: %s.%s invalid option %s", ErrInvalidIndArgs, i.Name, p.Name, v)
+			}
+			res[j] = float64(idx)
+		default:
+			return nil, fmt.Errorf("%w: %s.%s invalid type %T", ErrInvalidIndArgs, i.Name, p.Name, val)
+		}
+	}
+	if used < len(args) {
+		for k := range args {
+			if !slices.ContainsFunc(i.Params, func(p *IndParam) bool { return p.Name == k }) {
+				return nil, fmt.Errorf("%w: %s has no param %s", ErrInvalidIndArgs, i.Name, k)
+			}
+		}
+	}
+	return i.CheckArgs(res)
+}
+
+/*
+WarmUp return the number of leading bars whose first output is NaN for given parameters,
+missing trailing parameters use defaults. It's counted from the first valid value of inputs,
+for inputs like conditions, the actual length depends on data and this is the minimum.
+
+返回给定参数下第一个输出开头为NaN的bar数量，从输入的第一个有效值开始计算；依赖条件等输入时和数据有关，此为最小值
+*/
+func (i *IndInfo) WarmUp(params ...float64) int {
+	p, err := i.CheckArgs(params)
+	if err != nil {
+		return 0
+	}
+	return i.warmUp(p)
+}
+
+/*
+Call compute the indicator on current bar of e, return Series of all outputs.
+If ins is empty, inputs are read from BarEnv by their names.
+
+在e的当前bar上计算指标，返回所有输出序列。ins为空时按输入名从BarEnv读取
+*/
+func (i *IndInfo) Call(e *BarEnv, ins []*Series, params ...float64) ([]*Series, error) {
+	p, err := i.CheckArgs(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(ins) == 0 || i.UseEnv {
+		for _, name := range i.Inputs {
+			if !exprVars[name] {
+				return nil, fmt.Errorf("%w: %s input %s is required", ErrInvalidIndArgs, i.Name, name)
+			}
+		}
+		ins = make([]*Series, len(i.Inputs))
+		for j, name := range i.Inputs {
+			ins[j] = e.varSeries(name)
+		}
+	} else if len(ins) != len(i.Inputs) {
+		return nil, fmt.Errorf("%w: %s expects %d inputs, got %d", ErrInvalidIndArgs, i.Name,
+			len(i.Inputs), len(ins))
+	}
+	return i.call(e, ins, p), nil
+}
+
+/*
+CallVec compute the indicator on slices, ins should be in the same order as Inputs and have the same length.
+
+基于切片计算指标，ins需和Inputs顺序一致且长度相同
+*/
+func (i *IndInfo) CallVec(ins [][]float64, params ...float64) ([][]float64, error) {
+	p, err := i.CheckArgs(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(ins) != len(i.Inputs) {
+		return nil, fmt.Errorf("%w: %s expects %d inputs, got %d", ErrInvalidIndArgs, i.Name,
+			len(i.Inputs), len(ins))
+	}
+	for _, arr := range ins[1:] {
+		if len(arr) != len(ins[0]) {
+			return nil, fmt.Errorf("%w: %s inputs length mismatch", ErrInvalidIndArgs, i.Name)
+		}
+	}
+	return i.callVec(ins, p), nil
+}
+
+func intParam(name string, def, low, high float64) *IndParam {
+	return &IndParam{Name: name, Type: ParamInt, Default: def, Min: low, Max: high}
+}
+
+// periodParam integer parameter in [low, +Inf)
+func periodParam(name string, def, low float64) *IndParam {
+	return intParam(name, def, low, math.Inf(1))
+}
+
+func floatParam(name string, def, low, high float64) *IndParam {
+	return &IndParam{Name: name, Type: ParamFloat, Default: def, Min: low, Max: high}
+}
+
+func boolParam(name string, def bool) *IndParam {
+	return &IndParam{Name: name, Type: ParamBool, Default: boolVal(def), Min: 0, Max: 1}
+}
+
+func enumParam(name string, def int, options ...string) *IndParam {
+	return &IndParam{Name: name, Type: ParamEnum, Default: float64(def), Min: 0, Max: float64(len(options) - 1),
+		Options: options}
+}
+
+// fixWarm warm-up length not depending on parameters
+func fixWarm(num int) func(p []float64) int {
+	return func(p []float64) int {
+		return num
+	}
+}
+
+// periodWarm warm-up is p[0] - 1 + extra
+func periodWarm(extra int) func(p []float64) int {
+	return func(p []float64) int {
+		return int(p[0]) - 1 + extra
+	}
+}
+
+func outs(res ...*Series) []*Series {
+	return res
+}
+
+func outVecs(res ...[]float64) [][]float64 {
+	return res
+}
+
+// regPeriod register an indicator with one input series and a period
+func regPeriod(name string, def, low float64, warm func(p []float64) int, fn func(obj *Series, period int) *Series,
+	vec func(data []float64, period int) []float64) {
+	regInd(&IndInfo{
+		Name:    name,
+		Inputs:  []string{"close"},
+		Params:  []*IndParam{periodParam("period", def, low)},
+		Outputs: []string{strings.ToLower(name)},
+		warmUp:  warm,
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(fn(ins[0], int(p[0])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(vec(ins[0], int(p[0])))
+		},
+	})
+}
+
+// regHLCPeriod register an indicator with high, low, close and a period
+func regHLCPeriod(name string, def float64, warm func(p []float64) int,
+	fn func(high, low, close *Series, period int) *Series, vec func(high, low, close []float64, period int) []float64) {
+	regInd(&IndInfo{
+		Name:    name,
+		Inputs:  []string{"high", "low", "close"},
+		Params:  []*IndParam{periodParam("period", def, 1)},
+		Outputs: []string{strings.ToLower(name)},
+		warmUp:  warm,
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(fn(ins[0], ins[1], ins[2], int(p[0])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(vec(ins[0], ins[1], ins[2], int(p[0])))
+		},
+	})
+}
+
+// regEnvPeriod register an indicator which reads BarEnv with a period
+func regEnvPeriod(name string, inputs []string, def float64, warm func(p []float64) int,
+	fn func(e *BarEnv, period int) *Series, vec func(ins [][]float64, period int) []float64) {
+	regInd(&IndInfo{
+		Name:    name,
+		Inputs:  inputs,
+		UseEnv:  true,
+		Params:  []*IndParam{periodParam("period", def, 1)},
+		Outputs: []string{strings.ToLower(name)},
+		warmUp:  warm,
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(fn(e, int(p[0])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(vec(ins, int(p[0])))
+		},
+	})
+}
+
+/*
+replayVec compute a stateful indicator without vectorized version on slices, by feeding a temporary BarEnv.
+inputs are names of ins, missing fields of bars are NaN.
+
+对没有向量版本的指标，用临时BarEnv逐个bar计算
+*/
+func replayVec(inputs []string, ins [][]float64, run func(e *BarEnv) []*Series) [][]float64 {
+	frame, _ := ParseTFrame("1m")
+	env := NewBarEnvIn("", "", "", frame)
+	size := len(ins[0])
+	env.MaxCache = max(size, 1)
+	field := func(name string, j int) float64 {
+		if idx := slices.Index(inputs, name); idx >= 0 {
+			return ins[idx][j]
+		}
+		return math.NaN()
+	}
+	var res [][]float64
+	for j := 0; j < size; j++ {
+		env.OnBar2(int64(j)*frame.MSecs, int64(j+1)*frame.MSecs, field("open", j), field("high", j),
+			field("low", j), field("close", j), field("volume", j), field("info", j))
+		items := run(env)
+		if res == nil {
+			res = make([][]float64, len(items))
+			for k := range res {
+				res[k] = make([]float64, size)
+			}
+		}
+		for k, s := range items {
+			res[k][j] = s.Get(0)
+		}
+	}
+	return res
+}
+
+var (
+	hlcInputs  = []string{"high", "low", "close"}
+	hlcvInputs = []string{"high", "low", "close", "volume"}
+)
+
+func init() {
+	inf := math.Inf(1)
+	regInd(&IndInfo{
+		Name:    "AvgPrice",
+		Inputs:  hlcInputs,
+		UseEnv:  true,
+		Outputs: []string{"avgprice"},
+		warmUp:  fixWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(AvgPrice(e))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.HLC3(ins[0], ins[1], ins[2]))
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "HL2",
+		Inputs:  []string{"high", "low"},
+		Outputs: []string{"hl2"},
+		warmUp:  fixWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(HL2(ins[0], ins[1]))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.HL2(ins[0], ins[1]))
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "HLC3",
+		Inputs:  hlcInputs,
+		Outputs: []string{"hlc3"},
+		warmUp:  fixWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(HLC3(ins[0], ins[1], ins[2]))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.HLC3(ins[0], ins[1], ins[2]))
+		},
+	})
+	regPeriod("Sum", 20, 1, periodWarm(0), Sum, tav.Sum)
+	regPeriod("SMA", 20, 1, periodWarm(0), SMA, tav.SMA)
+	regInd(&IndInfo{
+		Name:    "VWMA",
+		Inputs:  []string{"close", "volume"},
+		Params:  []*IndParam{periodParam("period", 20, 1)},
+		Outputs: []string{"vwma"},
+		warmUp:  periodWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(VWMA(ins[0], ins[1], int(p[0])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.VWMA(ins[0], ins[1], int(p[0])))
+		},
+	})
+	regPeriod("EMA", 20, 1, periodWarm(0), EMA, tav.EMA)
+	regInd(&IndInfo{
+		Name:    "EMABy",
+		Inputs:  []string{"close"},
+		Params:  []*IndParam{periodParam("period", 20, 1), enumParam("initType", 0, "sma", "first")},
+		Outputs: []string{"ema"},
+		warmUp: func(p []float64) int {
+			if p[1] == 1 {
+				return 0
+			}
+			return int(p[0]) - 1
+		},
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(EMABy(ins[0], int(p[0]), int(p[1])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.EMABy(ins[0], int(p[0]), int(p[1])))
+		},
+	})
+	regPeriod("RMA", 20, 1, periodWarm(0), RMA, tav.RMA)
+	regInd(&IndInfo{
+		Name:   "RMABy",
+		Inputs: []string{"close"},
+		Params: []*IndParam{periodParam("period", 20, 1), enumParam("initType", 0, "sma", "first"),
+			floatParam("initVal", math.NaN(), math.Inf(-1), inf)},
+		Outputs: []string{"rma"},
+		warmUp: func(p []float64) int {
+			if p[1] == 1 {
+				return 0
+			}
+			return int(p[0]) - 1
+		},
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(RMABy(ins[0], int(p[0]), int(p[1]), p[2]))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.RMABy(ins[0], int(p[0]), int(p[1]), p[2]))
+		},
+	})
+	regPeriod("WMA", 9, 1, periodWarm(0), WMA, tav.WMA)
+	regPeriod("HMA", 9, 1, func(p []float64) int {
+		period := int(p[0])
+		return period - 1 + int(math.Floor(math.Sqrt(float64(period)))) - 1
+	}, HMA, tav.HMA)
+	regInd(&IndInfo{
+		Name:    "TR",
+		Inputs:  hlcInputs,
+		Outputs: []string{"tr"},
+		warmUp:  fixWarm(1),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(TR(ins[0], ins[1], ins[2]))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.TR(ins[0], ins[1], ins[2]))
+		},
+	})
+	regHLCPeriod("ATR", 14, periodWarm(1), ATR, tav.ATR)
+	regInd(&IndInfo{
+		Name:    "MACD",
+		Inputs:  []string{"close"},
+		Params:  []*IndParam{periodParam("fast", 12, 1), periodParam("slow", 26, 1), periodParam("smooth", 9, 1)},
+		Outputs: []string{"macd", "signal"},
+		warmUp:  macdWarm,
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(MACD(ins[0], int(p[0]), int(p[1]), int(p[2])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.MACD(ins[0], int(p[0]), int(p[1]), int(p[2])))
+		},
+	})
+	regInd(&IndInfo{
+		Name:   "MACDBy",
+		Inputs: []string{"close"},
+		Params: []*IndParam{periodParam("fast", 12, 1), periodParam("slow", 26, 1), periodParam("smooth", 9, 1),
+			enumParam("initType", 0, "sma", "first")},
+		Outputs: []string{"macd", "signal"},
+		warmUp: func(p []float64) int {
+			if p[3] == 1 {
+				return 0
+			}
+			return macdWarm(p)
+		},
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(MACDBy(ins[0], int(p[0]), int(p[1]), int(p[2]), int(p[3])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.MACDBy(ins[0], int(p[0]), int(p[1]), int(p[2]), int(p[3])))
+		},
+	})
+	regPeriod("RSI", 14, 1, periodWarm(1), RSI, tav.RSI)
+	regPeriod("RSI50", 14, 1, periodWarm(1), RSI50, func(data []float64, period int) []float64 {
+		return tav.RSIBy(data, period, 50)
+	})
+	regInd(&IndInfo{
+		Name:    "CRSI",
+		Inputs:  []string{"close"},
+		Params:  []*IndParam{periodParam("period", 3, 1), periodParam("upDn", 2, 1), periodParam("roc", 100, 1)},
+		Outputs: []string{"crsi"},
+		warmUp:  crsiWarm,
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(CRSI(ins[0], int(p[0]), int(p[1]), int(p[2])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.CRSI(ins[0], int(p[0]), int(p[1]), int(p[2])))
+		},
+	})
+	regInd(&IndInfo{
+		Name:   "CRSIBy",
+		Inputs: []string{"close"},
+		Params: []*IndParam{periodParam("period", 3, 1), periodParam("upDn", 2, 1), periodParam("roc", 100, 1),
+			enumParam("vtype", 0, "tradingview", "talib")},
+		Outputs: []string{"crsi"},
+		warmUp:  crsiWarm,
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(CRSIBy(ins[0], int(p[0]), int(p[1]), int(p[2]), int(p[3])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.CRSIBy(ins[0], int(p[0]), int(p[1]), int(p[2]), int(p[3])))
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "UpDown",
+		Inputs:  []string{"close"},
+		Params:  []*IndParam{enumParam("vtype", 0, "tradingview", "classic")},
+		Outputs: []string{"updown"},
+		warmUp:  fixWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(UpDown(ins[0], int(p[0])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.UpDown(ins[0], int(p[0])))
+		},
+	})
+	regPeriod("PercentRank", 20, 1, periodWarm(0), PercentRank, tav.PercentRank)
+	regPeriod("Highest", 20, 1, periodWarm(0), Highest, tav.Highest)
+	regPeriod("HighestBar", 20, 1, periodWarm(0), HighestBar, tav.HighestBar)
+	regPeriod("Lowest", 20, 1, periodWarm(0), Lowest, tav.Lowest)
+	regPeriod("LowestBar", 20, 1, periodWarm(0), LowestBar, tav.LowestBar)
+	regInd(&IndInfo{
+		Name:    "KDJ",
+		Inputs:  hlcInputs,
+		Params:  []*IndParam{periodParam("period", 9, 1), periodParam("sm1", 3, 1), periodParam("sm2", 3, 1)},
+		Outputs: []string{"k", "d", "rsv"},
+		warmUp:  periodWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(KDJ(ins[0], ins[1], ins[2], int(p[0]), int(p[1]), int(p[2])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.KDJ(ins[0], ins[1], ins[2], int(p[0]), int(p[1]), int(p[2])))
+		},
+	})
+	regInd(&IndInfo{
+		Name:   "KDJBy",
+		Inputs: hlcInputs,
+		Params: []*IndParam{periodParam("period", 9, 1), periodParam("sm1", 3, 1), periodParam("sm2", 3, 1),
+			enumParam("maBy", 0, "rma", "sma")},
+		Outputs: []string{"k", "d", "rsv"},
+		warmUp: func(p []float64) int {
+			if p[3] == 1 {
+				// SMA平滑
+				return int(p[0]+p[1]) - 2
+			}
+			return int(p[0]) - 1
+		},
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(KDJBy(ins[0], ins[1], ins[2], int(p[0]), int(p[1]), int(p[2]), kdjMaBy(p[3])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.KDJBy(ins[0], ins[1], ins[2], int(p[0]), int(p[1]), int(p[2]), kdjMaBy(p[3])))
+		},
+	})
+	regHLCPeriod("Stoch", 14, periodWarm(0), Stoch, tav.Stoch)
+	regInd(&IndInfo{
+		Name:    "Aroon",
+		Inputs:  []string{"high", "low"},
+		Params:  []*IndParam{periodParam("period", 14, 1)},
+		Outputs: []string{"up", "osc", "down"},
+		warmUp:  periodWarm(1),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(Aroon(ins[0], ins[1], int(p[0])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.Aroon(ins[0], ins[1], int(p[0])))
+		},
+	})
+	regPeriod("StdDev", 20, 1, periodWarm(0), StdDev, tav.StdDev)
+	regInd(&IndInfo{
+		Name:    "StdDevBy",
+		Inputs:  []string{"close"},
+		Params:  []*IndParam{periodParam("period", 20, 1), intParam("ddof", 0, 0, inf)},
+		Outputs: []string{"stddev", "mean"},
+		warmUp:  periodWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(StdDevBy(ins[0], int(p[0]), int(p[1])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.StdDevBy(ins[0], int(p[0]), int(p[1])))
+		},
+	})
+	regInd(&IndInfo{
+		Name:   "BBANDS",
+		Inputs: []string{"close"},
+		Params: []*IndParam{periodParam("period", 20, 1), floatParam("stdUp", 2, 0, inf),
+			floatParam("stdDn", 2, 0, inf)},
+		Outputs: []string{"upper", "mid", "lower"},
+		warmUp:  periodWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(BBANDS(ins[0], int(p[0]), p[1], p[2]))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.BBANDS(ins[0], int(p[0]), p[1], p[2]))
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "TD",
+		Inputs:  []string{"close"},
+		Outputs: []string{"td"},
+		warmUp:  fixWarm(4),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(TD(ins[0]))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.TD(ins[0]))
+		},
+	})
+	regHLCPeriod("ADX", 14, func(p []float64) int {
+		return int(p[0])*2 - 1
+	}, ADX, tav.ADX)
+	regInd(&IndInfo{
+		Name:   "ADXBy",
+		Inputs: hlcInputs,
+		Params: []*IndParam{periodParam("period", 14, 1), intParam("smoothing", 0, 0, inf),
+			enumParam("method", 0, "classic", "tradingview")},
+		Outputs: []string{"adx"},
+		warmUp: func(p []float64) int {
+			smooth := int(p[1])
+			if smooth == 0 {
+				smooth = int(p[0])
+			}
+			return int(p[0]) + smooth - 1
+		},
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(ADXBy(ins[0], ins[1], ins[2], int(p[0]), int(p[1]), int(p[2])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.ADXBy(ins[0], ins[1], ins[2], int(p[0]), int(p[1]), int(p[2])))
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "PluMinDI",
+		Inputs:  hlcInputs,
+		Params:  []*IndParam{periodParam("period", 14, 1)},
+		Outputs: []string{"plus", "minus"},
+		warmUp:  periodWarm(1),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(PluMinDI(ins[0], ins[1], ins[2], int(p[0])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.PluMinDI(ins[0], ins[1], ins[2], int(p[0])))
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "PluMinDM",
+		Inputs:  hlcInputs,
+		Params:  []*IndParam{periodParam("period", 14, 1)},
+		Outputs: []string{"plus", "minus"},
+		warmUp:  periodWarm(1),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(PluMinDM(ins[0], ins[1], ins[2], int(p[0])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.PluMinDM(ins[0], ins[1], ins[2], int(p[0])))
+		},
+	})
+	regPeriod("ROC", 9, 1, periodWarm(1), ROC, tav.ROC)
+	regInd(&IndInfo{
+		Name:    "HeikinAshi",
+		Inputs:  []string{"open", "high", "low", "close"},
+		UseEnv:  true,
+		Outputs: []string{"open", "high", "low", "close"},
+		warmUp:  fixWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(HeikinAshi(e))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.HeikinAshi(ins[0], ins[1], ins[2], ins[3]))
+		},
+	})
+	regPeriod("ER", 8, 1, periodWarm(1), ER, tav.ER)
+	regPeriod("AvgDev", 20, 1, periodWarm(0), AvgDev, tav.AvgDev)
+	regPeriod("CCI", 20, 1, periodWarm(0), CCI, tav.CCI)
+	regEnvPeriod("CMF", hlcvInputs, 20, periodWarm(0), CMF, func(ins [][]float64, period int) []float64 {
+		return tav.CMF(ins[0], ins[1], ins[2], ins[3], period)
+	})
+	regInd(&IndInfo{
+		Name:    "ADL",
+		Inputs:  hlcvInputs,
+		UseEnv:  true,
+		Outputs: []string{"adl"},
+		warmUp:  fixWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(ADL(e))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return replayVec(hlcvInputs, ins, func(e *BarEnv) []*Series {
+				return outs(ADL(e))
+			})
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "ChaikinOsc",
+		Inputs:  hlcvInputs,
+		UseEnv:  true,
+		Params:  []*IndParam{periodParam("short", 3, 1), periodParam("long", 10, 1)},
+		Outputs: []string{"chaikinosc"},
+		warmUp: func(p []float64) int {
+			return max(int(p[0]), int(p[1])) - 1
+		},
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(ChaikinOsc(e, int(p[0]), int(p[1])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return replayVec(hlcvInputs, ins, func(e *BarEnv) []*Series {
+				return outs(ChaikinOsc(e, int(p[0]), int(p[1])))
+			})
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "CVD",
+		Inputs:  []string{"volume", "buy"},
+		UseEnv:  true,
+		Outputs: []string{"cvd"},
+		warmUp:  fixWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(CVD(e))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.CVD(ins[0], ins[1]))
+		},
+	})
+	regEnvPeriod("QVWAP", []string{"quote", "volume"}, 20, periodWarm(0), QVWAP,
+		func(ins [][]float64, period int) []float64 {
+			return tav.QVWAP(ins[0], ins[1], period)
+		})
+	regEnvPeriod("AvgTradeSize", []string{"volume", "trades"}, 20, periodWarm(0), AvgTradeSize,
+		func(ins [][]float64, period int) []float64 {
+			return tav.AvgTradeSize(ins[0], ins[1], period)
+		})
+	regPeriod("KAMA", 10, 1, periodWarm(1), KAMA, tav.KAMA)
+	regInd(&IndInfo{
+		Name:   "KAMABy",
+		Inputs: []string{"close"},
+		Params: []*IndParam{periodParam("period", 10, 1), periodParam("fast", 2, 1),
+			periodParam("slow", 30, 1)},
+		Outputs: []string{"kama"},
+		warmUp:  periodWarm(1),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(KAMABy(ins[0], int(p[0]), int(p[1]), int(p[2])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.KAMABy(ins[0], int(p[0]), int(p[1]), int(p[2])))
+		},
+	})
+	regEnvPeriod("WillR", hlcInputs, 14, periodWarm(0), WillR, func(ins [][]float64, period int) []float64 {
+		return tav.WillR(ins[0], ins[1], ins[2], period)
+	})
+	regInd(&IndInfo{
+		Name:   "StochRSI",
+		Inputs: []string{"close"},
+		Params: []*IndParam{periodParam("rsiLen", 14, 1), periodParam("stochLen", 14, 1),
+			periodParam("maK", 3, 1), periodParam("maD", 3, 1)},
+		Outputs: []string{"fastK", "fastD"},
+		warmUp: func(p []float64) int {
+			return int(p[0]+p[1]+p[2]) - 2
+		},
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(StochRSI(ins[0], int(p[0]), int(p[1]), int(p[2]), int(p[3])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.StochRSI(ins[0], int(p[0]), int(p[1]), int(p[2]), int(p[3])))
+		},
+	})
+	regEnvPeriod("MFI", hlcvInputs, 14, periodWarm(0), MFI, func(ins [][]float64, period int) []float64 {
+		return tav.MFI(ins[0], ins[1], ins[2], ins[3], period)
+	})
+	regInd(&IndInfo{
+		Name:    "RMI",
+		Inputs:  []string{"close"},
+		Params:  []*IndParam{periodParam("period", 14, 1), periodParam("montLen", 3, 1)},
+		Outputs: []string{"rmi"},
+		warmUp: func(p []float64) int {
+			return int(p[0]+p[1]) - 1
+		},
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(RMI(ins[0], int(p[0]), int(p[1])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.RMI(ins[0], int(p[0]), int(p[1])))
+		},
+	})
+	regPeriod("LinReg", 20, 1, periodWarm(0), LinReg, tav.LinReg)
+	regInd(&IndInfo{
+		Name:   "LinRegAdv",
+		Inputs: []string{"close"},
+		Params: []*IndParam{periodParam("period", 20, 1), boolParam("angle", false), boolParam("intercept", false),
+			boolParam("degrees", false), boolParam("r", false), boolParam("slope", false), boolParam("tsf", false)},
+		Outputs: []string{"linreg"},
+		warmUp:  periodWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(LinRegAdv(ins[0], int(p[0]), p[1] != 0, p[2] != 0, p[3] != 0, p[4] != 0, p[5] != 0, p[6] != 0))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.LinRegAdv(ins[0], int(p[0]), p[1] != 0, p[2] != 0, p[3] != 0, p[4] != 0, p[5] != 0,
+				p[6] != 0))
+		},
+	})
+	regPeriod("CTI", 20, 1, periodWarm(0), CTI, tav.CTI)
+	regPeriod("CMO", 9, 1, periodWarm(1), CMO, tav.CMO)
+	regInd(&IndInfo{
+		Name:    "CMOBy",
+		Inputs:  []string{"close"},
+		Params:  []*IndParam{periodParam("period", 9, 1), enumParam("maType", 0, "talib", "tradingview")},
+		Outputs: []string{"cmo"},
+		warmUp:  periodWarm(1),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(CMOBy(ins[0], int(p[0]), int(p[1])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.CMOBy(ins[0], int(p[0]), int(p[1])))
+		},
+	})
+	regEnvPeriod("CHOP", hlcInputs, 14, periodWarm(1), CHOP, func(ins [][]float64, period int) []float64 {
+		return tav.CHOP(ins[0], ins[1], ins[2], period)
+	})
+	regInd(&IndInfo{
+		Name:   "ALMA",
+		Inputs: []string{"close"},
+		Params: []*IndParam{periodParam("period", 10, 1), floatParam("sigma", 6, 0, inf),
+			floatParam("distOff", 0.85, 0, 1)},
+		Outputs: []string{"alma"},
+		warmUp:  periodWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(ALMA(ins[0], int(p[0]), p[1], p[2]))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.ALMA(ins[0], int(p[0]), p[1], p[2]))
+		},
+	})
+	regInd(&IndInfo{
+		Name:   "Stiffness",
+		Inputs: []string{"close"},
+		Params: []*IndParam{periodParam("maLen", 100, 1), periodParam("stiffLen", 60, 1),
+			periodParam("stiffMa", 3, 1)},
+		Outputs: []string{"stiffness"},
+		warmUp: func(p []float64) int {
+			return int(p[0]+p[1]+p[2]) - 3
+		},
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(Stiffness(ins[0], int(p[0]), int(p[1]), int(p[2])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.Stiffness(ins[0], int(p[0]), int(p[1]), int(p[2])))
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "DV2",
+		Inputs:  hlcInputs,
+		Params:  []*IndParam{periodParam("period", 252, 1), periodParam("maLen", 2, 1)},
+		Outputs: []string{"dv2"},
+		warmUp:  periodWarm(1),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(DV2(ins[0], ins[1], ins[2], int(p[0]), int(p[1])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.DV2(ins[0], ins[1], ins[2], int(p[0]), int(p[1])))
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "UTBot",
+		Inputs:  []string{"close", "atr"},
+		Params:  []*IndParam{floatParam("rate", 1, 0, inf)},
+		Outputs: []string{"utbot"},
+		warmUp:  fixWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(UTBot(ins[0], ins[1], p[0]))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.UTBot(ins[0], ins[1], p[0]))
+		},
+	})
+	regInd(&IndInfo{
+		Name:   "STC",
+		Inputs: []string{"close"},
+		Params: []*IndParam{periodParam("period", 12, 1), periodParam("fast", 26, 1), periodParam("slow", 50, 1),
+			floatParam("alpha", 0.5, 0, 1)},
+		Outputs: []string{"stc"},
+		warmUp: func(p []float64) int {
+			return int(max(p[1], p[2])) - 1
+		},
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(STC(ins[0], int(p[0]), int(p[1]), int(p[2]), p[3]))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.STC(ins[0], int(p[0]), int(p[1]), int(p[2]), p[3]))
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "BarsSince",
+		Inputs:  []string{"cond"},
+		Outputs: []string{"barssince"},
+		warmUp:  fixWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(BarsSince(ins[0]))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.BarsSince(ins[0]))
+		},
+	})
+	regInd(&IndInfo{
+		Name:    "ValueWhen",
+		Inputs:  []string{"cond", "close"},
+		Params:  []*IndParam{intParam("occurrence", 0, 0, inf)},
+		Outputs: []string{"valuewhen"},
+		warmUp:  fixWarm(0),
+		call: func(e *BarEnv, ins []*Series, p []float64) []*Series {
+			return outs(ValueWhen(ins[0], ins[1], int(p[0])))
+		},
+		callVec: func(ins [][]float64, p []float64) [][]float64 {
+			return outVecs(tav.ValueWhen(ins[0], ins[1], int(p[0])))
+		},
+	})
+	regPeriod("Rising", 1, 1, periodWarm(1), Rising, tav.Rising)
+	regPeriod("Falling", 1, 1, periodWarm(1), Falling, tav.Falling)
+	regPeriod("Change", 1, 1, periodWarm(1), Change, tav.Change)
+}
+
+func crsiWarm(p []float64) int {
+	return int(max(p[0], p[1], p[2]))
+}
+
+func macdWarm(p []float64) int {
+	return int(max(p[0], p[1])) - 1
+}
+
+func kdjMaBy(v float64) string {
+	if v == 1 {
+		return "sma"
+	}
+	return "rma"
+}
@@ -0,0 +1,153 @@
+package banta
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/banbox/banta/tav"
+)
+
+// waveKlines generate klines long enough for warm-up of all indicators with default params
+func waveKlines(num int) []Kline {
+	res := make([]Kline, num)
+	price := 100.0
+	for i := range res {
+		x := float64(i)
+		open := price
+		price = 100 + 10*math.Sin(x/7) + 3*math.Sin(x/3.1) + x*0.02
+		res[i] = Kline{
+			Time:   1688169600000 + int64(i)*86400000,
+			Open:   open,
+			High:   max(open, price) + 1 + math.Abs(math.Sin(x/2)),
+			Low:    min(open, price) - 1 - math.Abs(math.Cos(x/5)),
+			Close:  price,
+			Volume: 1000 + 500*math.Sin(x/4),
+		}
+		res[i].QuoteVolume = res[i].Volume * (open + price) / 2
+		res[i].TradeNum = math.Round(80 + 30*math.Sin(x/6))
+		res[i].BuyVolume = res[i].Volume * (0.5 + 0.3*math.Sin(x/5))
+	}
+	return res
+}
+
+func nanPrefix(arr []float64) int {
+	num := 0
+	for num < len(arr) && math.IsNaN(arr[num]) {
+		num++
+	}
+	return num
+}
+
+func TestRegistry(t *testing.T) {
+	klines := waveKlines(400)
+	o, h, l, c, v, i := extractOHLCV(klines)
+	vecs := map[string][]float64{"open": o, "high": h, "low": l, "close": c, "volume": v, "info": i,
+		"atr": tav.ATR(h, l, c, 14)}
+	for _, k := range klines {
+		vecs["quote"] = append(vecs["quote"], k.QuoteVolume)
+		vecs["trades"] = append(vecs["trades"], k.TradeNum)
+		vecs["buy"] = append(vecs["buy"], k.BuyVolume)
+	}
+	cond := make([]float64, len(c))
+	for j := range c {
+		cond[j] = boolVal(c[j] > o[j])
+	}
+	vecs["cond"] = cond
+	liveIn := func(e *BarEnv, name string) *Series {
+		switch name {
+		case "atr":
+			return ATR(e.High, e.Low, e.Close, 14)
+		case "cond":
+			return e.Close.Greater(e.Open)
+		}
+		return e.varSeries(name)
+	}
+	inds := Indicators()
+	if len(inds) < 68 {
+		t.Fatalf("expect all indicators registered, got %d", len(inds))
+	}
+	for _, ind := range inds {
+		ins := make([][]float64, len(ind.Inputs))
+		for j, name := range ind.Inputs {
+			ins[j] = vecs[name]
+		}
+		expects, err := ind.CallVec(ins)
+		if err != nil {
+			t.Fatalf("%s: %v", ind.Name, err)
+		}
+		if len(expects) != len(ind.Outputs) {
+			t.Fatalf("%s: expect %d outputs, got %d", ind.Name, len(ind.Outputs), len(expects))
+		}
+		warm, inWarm := nanPrefix(expects[0]), 0
+		for _, arr := range ins {
+			inWarm = max(inWarm, nanPrefix(arr))
+		}
+		// 依赖条件输入的预热长度和数据有关
+		hasCond := slices.Contains(ind.Inputs, "cond")
+		if hasCond && warm < ind.WarmUp() || !hasCond && warm != ind.WarmUp()+inWarm {
+			t.Errorf("%s: warm-up expect %d, got %d", ind.Name, warm-inWarm, ind.WarmUp())
+		}
+		env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+		for j := range klines {
+			if err = env.OnKline(&klines[j]); err != nil {
+				t.Fatal(err)
+			}
+			var serIns []*Series
+			if !ind.UseEnv {
+				for _, name := range ind.Inputs {
+					serIns = append(serIns, liveIn(env, name))
+				}
+			}
+			res, err := ind.Call(env, serIns)
+			if err != nil {
+				t.Fatalf("%s: %v", ind.Name, err)
+			}
+			for n, s := range res {
+				if !equalNearly(s.Get(0), expects[n][j]) {
+					t.Fatalf("%s.%s bar %d: live %v, vec %v", ind.Name, ind.Outputs[n], j, s.Get(0), expects[n][j])
+				}
+			}
+		}
+	}
+}
+
+func TestRegistryArgs(t *testing.T) {
+	ind := GetIndicator("macd")
+	if ind == nil || ind.Name != "MACD" {
+		t.Fatalf("expect MACD, got %v", ind)
+	}
+	if GetIndicator("FOO") != nil {
+		t.Errorf("expect nil for unknown indicator")
+	}
+	if ind.WarmUp() != 25 || ind.WarmUp(5, 10, 3) != 9 {
+		t.Errorf("bad MACD warm-up: %d %d", ind.WarmUp(), ind.WarmUp(5, 10, 3))
+	}
+	args, err := ind.ParseArgs(map[string]interface{}{"fast": 6, "smooth": 4.0})
+	if err != nil || args[0] != 6 || args[1] != 26 || args[2] != 4 {
+		t.Errorf("bad parsed args: %v %v", args, err)
+	}
+	kdj := GetIndicator("KDJBy")
+	args, err = kdj.ParseArgs(map[string]interface{}{"maBy": "sma"})
+	if err != nil || args[3] != 1 {
+		t.Errorf("bad enum arg: %v %v", args, err)
+	}
+	bads := []map[string]interface{}{
+		{"fast": 0},
+		{"fast": 2.5},
+		{"slow": "abc"},
+		{"period": 3},
+	}
+	for _, item := range bads {
+		if _, err = ind.ParseArgs(item); !errors.Is(err, ErrInvalidIndArgs) {
+			t.Errorf("expect ErrInvalidIndArgs for %v, got %v", item, err)
+		}
+	}
+	if _, err = ind.CallVec([][]float64{{1, 2}}, 1, 2, 3, 4); !errors.Is(err, ErrInvalidIndArgs) {
+		t.Errorf("expect ErrInvalidIndArgs for too many params, got %v", err)
+	}
+	if _, err = GetIndicator("UTBot").Call(nil, nil); !errors.Is(err, ErrInvalidIndArgs) {
+		t.Errorf("expect ErrInvalidIndArgs for missing input, got %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+package banta
+
+import (
+	"fmt"
+	"math"
+)
+
+// barListener receive bars from a source BarEnv, such as a resampled higher timeframe env
+type barListener interface {
+	onSrcBar(src *BarEnv, bar *Kline, endMS int64)
+	onSrcUpdate(src *BarEnv, bar *Kline) error
+	reset()
+}
+
+// resampler aggregate bars of source env into a higher timeframe env
+type resampler struct {
+	env        *BarEnv
+	bar        Kline // 正在形成的大周期K线，Time为开始时间
+	stop       int64
+	active     bool
+	prev       Kline // 合并最新小周期K线之前的状态，用于OnBarUpdate
+	prevActive bool
+	closed     bool // 最新的小周期K线是否完成了大周期K线
+	started    bool // 是否已开始过大周期K线，之后缺失边界K线时从首个可用的小周期K线开始
+}
+
+/*
+Resample create or get a higher timeframe BarEnv, which is updated automatically when bars
+are fed to this env. A bar of the new env is finished when the end of source bar reaches its boundary,
+use FormingBar on the new env to get the unfinished bar.
+
+Volume and extended fields are summed, Info takes the latest value. The first higher timeframe bar is skipped if it starts in the middle,
+later bars missing source bars at the boundary start from the first available source bar.
+
+从当前BarEnv派生更大周期的BarEnv，小周期K线推送时自动聚合，到达边界时完成大周期K线。
+未完成的大周期K线可通过FormingBar获取。首个大周期K线从中间开始时跳过，之后缺少边界处小周期K线时从首个可用的开始。
+*/
+func (e *BarEnv) Resample(timeframe string) (*BarEnv, error) {
+	e.lockListen.Lock()
+	defer e.lockListen.Unlock()
+	for _, l := range e.listeners {
+		if r, ok := l.(*resampler); ok && r.env.TimeFrame == timeframe {
+			return r.env, nil
+		}
+	}
+	var frame *TFrame
+	var err error
+	if e.Frame != nil {
+		frame, err = e.Frame.Derive(timeframe)
+	} else {
+		frame, err = ParseTFrame(timeframe)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := NewBarEnvIn(e.Exchange, e.MarketType, e.Symbol, frame)
+	if res.TFMSecs <= e.TFMSecs || res.TFMSecs%e.TFMSecs != 0 {
+		return nil, fmt.Errorf("cannot resample %s to %s", e.TimeFrame, timeframe)
+	}
+	res.MaxCache = e.MaxCache
+	r := &resampler{env: res}
+	res.resample = r
+	e.listeners = append(e.listeners, r)
+	return res, nil
+}
+
+/*
+FormingBar return a copy of the unfinished bar of a resampled BarEnv, nil if not exist.
+
+返回重采样BarEnv中未完成的K线，不存在时返回nil
+*/
+func (e *BarEnv) FormingBar() *Kline {
+	r := e.resample
+	if r == nil || !r.active {
+		return nil
+	}
+	bar := r.bar
+	return &bar
+}
+
+// notifyBar send the new bar to all listeners
+func (e *BarEnv) notifyBar() {
+	e.lockListen.Lock()
+	listeners := e.listeners
+	e.lockListen.Unlock()
+	if len(listeners) == 0 {
+		return
+	}
+	bar := e.lastBar()
+	for _, l := range listeners {
+		l.onSrcBar(e, bar, e.TimeStop)
+	}
+}
+
+// notifyUpdate send the updated latest bar to all listeners
+func (e *BarEnv) notifyUpdate() error {
+	e.lockListen.Lock()
+	listeners := e.listeners
+	e.lockListen.Unlock()
+	if len(listeners) == 0 {
+		return nil
+	}
+	bar := e.lastBar()
+	for _, l := range listeners {
+		if err := l.onSrcUpdate(e, bar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *BarEnv) lastBar() *Kline {
+	return &Kline{
+		Time:        e.TimeStart,
+		Open:        e.Open.Get(0),
+		High:        e.High.Get(0),
+		Low:         e.Low.Get(0),
+		Close:       e.Close.Get(0),
+		Volume:      e.Volume.Get(0),
+		Info:        e.Info.Get(0),
+		QuoteVolume: extVal(e.QuoteVolume),
+		TradeNum:    extVal(e.TradeNum),
+		BuyVolume:   extVal(e.BuyVolume),
+	}
+}
+
+func (r *resampler) barStart(ms int64) int64 {
+	return r.env.Frame.BarStart(ms)
+}
+
+func (r *resampler) onSrcBar(src *BarEnv, bar *Kline, endMS int64) {
+	start := r.barStart(bar.Time)
+	if r.active && start != r.bar.Time {
+		// 缺少边界处的小周期K线，先完成上一个
+		r.emit(src)
+	}
+	r.prev, r.prevActive = r.bar, r.active
+	r.closed = false
+	if r.skip(bar, start) {
+		return
+	}
+	r.merge(bar, start)
+	if endMS >= r.stop {
+		r.emit(src)
+		r.closed = true
+	}
+}
+
+func (r *resampler) onSrcUpdate(src *BarEnv, bar *Kline) error {
+	start := r.barStart(bar.Time)
+	r.bar, r.active = r.prev, r.prevActive
+	if r.skip(bar, start) {
+		return nil
+	}
+	r.merge(bar, start)
+	if !r.closed {
+		return nil
+	}
+	// 此小周期K线已完成大周期K线，更新大周期的最新K线
+	r.active = false
+	b := r.bar
+	if src.QuoteVolume != nil {
+		return r.env.OnKlineUpdate(&b)
+	}
+	return r.env.OnBarUpdate(b.Time, b.Open, b.High, b.Low, b.Close, b.Volume, b.Info)
+}
+
+// skip check whether bar is in the first higher timeframe bar which starts in the middle
+func (r *resampler) skip(bar *Kline, start int64) bool {
+	return !r.active && !r.started && bar.Time != start
+}
+
+func (r *resampler) merge(bar *Kline, start int64) {
+	if !r.active {
+		r.bar = *bar
+		r.bar.Time = start
+		r.stop = r.env.barEnd(start)
+		r.active = true
+		r.started = true
+		return
+	}
+	b := &r.bar
+	if math.IsNaN(b.Open) {
+		b.Open = bar.Open
+	}
+	if math.IsNaN(b.High) || bar.High > b.High {
+		b.High = bar.High
+	}
+	if math.IsNaN(b.Low) || bar.Low < b.Low {
+		b.Low = bar.Low
+	}
+	if !math.IsNaN(bar.Close) {
+		b.Close = bar.Close
+	}
+	b.Volume = addNaN(b.Volume, bar.Volume)
+	b.QuoteVolume = addNaN(b.QuoteVolume, bar.QuoteVolume)
+	b.TradeNum = addNaN(b.TradeNum, bar.TradeNum)
+	b.BuyVolume = addNaN(b.BuyVolume, bar.BuyVolume)
+	if !math.IsNaN(bar.Info) {
+		b.Info = bar.Info
+	}
+}
+
+// emit finish the forming bar and send it to the higher timeframe env
+func (r *resampler) emit(src *BarEnv) {
+	b := r.bar
+	r.active = false
+	r.env.Intrabar = src.Intrabar
+	if src.QuoteVolume != nil {
+		r.env.extBar = &b
+	}
+	r.env.OnBar2(b.Time, r.stop, b.Open, b.High, b.Low, b.Close, b.Volume, b.Info)
+}
+
+func (r *resampler) reset() {
+	r.active = false
+	r.prevActive = false
+	r.closed = false
+	r.started = false
+	r.env.Reset()
+}
+
+const (
+	SecLastClosed = iota // 使用结束时间不晚于当前bar的K线，无未来函数
+	SecForming           // 使用开始时间不晚于当前bar的K线，可能是未完成的
+)
+
+/*
+Security map a Series of another BarEnv (usually a higher timeframe) onto the bar clock of dst,
+like request.security in TradingView.
+
+mode: SecLastClosed use the latest src bar which ends before the end of current dst bar (lookahead_off);
+SecForming use the src bar which contains current dst bar, it may be unfinished.
+When src env is created by Resample, its bars are only added when finished, SecForming reads OHLCV and extended
+fields from FormingBar, other Series (such as indicators) have no value on the forming bar, the latest finished
+value is used.
+
+将其他BarEnv的序列对齐到dst的bar上。SecLastClosed只使用已完成的K线；SecForming使用包含当前bar的K线。
+src由Resample创建时，只有完成的K线会添加到其中，SecForming从FormingBar读取OHLCV和扩展字段，
+其他序列（如指标）在未完成的K线上没有值，使用最近完成的值
+*/
+func Security(src *Series, dst *BarEnv, mode int) *Series {
+	res := dst.Close.ToKey(Key("_security", src.Env.uniqID(), src, mode))
+	if res.Cached() {
+		return res
+	}
+	res.LockData.Lock()
+	if !res.Cached() {
+		var val float64
+		var ok bool
+		if mode == SecForming {
+			val, ok = src.formingVal(dst)
+		}
+		if !ok {
+			val = src.Get(src.alignOffset(dst, mode))
+		}
+		res.Append(val)
+	}
+	res.LockData.Unlock()
+	return res
+}
+
+// formingVal return the value of root s in the forming bar of a resampled env, if it contains current bar of dst
+func (s *Series) formingVal(dst *BarEnv) (float64, bool) {
+	e := s.Env
+	bar := e.FormingBar()
+	if bar == nil || bar.Time > dst.TimeStart || e.resample.stop <= dst.TimeStart {
+		return 0, false
+	}
+	switch s {
+	case e.Open:
+		return bar.Open, true
+	case e.High:
+		return bar.High, true
+	case e.Low:
+		return bar.Low, true
+	case e.Close:
+		return bar.Close, true
+	case e.Volume:
+		return bar.Volume, true
+	case e.Info:
+		return bar.Info, true
+	case e.QuoteVolume:
+		return bar.QuoteVolume, true
+	case e.TradeNum:
+		return bar.TradeNum, true
+	case e.BuyVolume:
+		return bar.BuyVolume, true
+	}
+	return 0, false
+}
+
+// lastStop return the end time of the bar for latest value
+func (s *Series) lastStop() int64 {
+	e := s.Env
+	if s.Time >= e.TimeStop || e.isRoot(s) {
+		return e.TimeStop
+	}
+	// not computed on the latest bar
+	return s.Time
+}
+
+// alignOffset return the index of value which is aligned to current bar of dst
+func (s *Series) alignOffset(dst *BarEnv, mode int) int {
+	e := s.Env
+	stop, limit := s.lastStop(), dst.TimeStop
+	if mode == SecForming {
+		// 比较开始时间，即上一个bar的结束时间
+		stop, limit = e.prevStop(stop), dst.TimeStart
+	}
+	if e.Frame != nil && e.Frame.IsCalendar() {
+		// 日历周期长度不固定，逐个向前查找
+		num := 0
+		for ; stop > limit; num++ {
+			stop = e.prevStop(stop)
+		}
+		return num
+	}
+	over := stop - limit
+	if over <= 0 {
+		return 0
+	}
+	return int((over + e.TFMSecs - 1) / e.TFMSecs)
+}
@@ -0,0 +1,185 @@
+package banta
+
+import (
+	"math"
+	"testing"
+)
+
+// aggBars aggregate klines by fixed interval, skip the first incomplete group
+func aggBars(klines []Kline, tfMSecs, srcMSecs int64) (closed []Kline, forming *Kline) {
+	for _, k := range klines {
+		start := k.Time - k.Time%tfMSecs
+		if forming != nil && forming.Time != start {
+			// 缺少边界处的K线
+			closed = append(closed, *forming)
+			forming = nil
+		}
+		if forming == nil {
+			if len(closed) == 0 && k.Time != start {
+				continue
+			}
+			bar := k
+			bar.Time = start
+			forming = &bar
+		} else {
+			forming.High = max(forming.High, k.High)
+			forming.Low = min(forming.Low, k.Low)
+			forming.Close = k.Close
+			forming.Volume += k.Volume
+		}
+		if k.Time+srcMSecs >= start+tfMSecs {
+			closed = append(closed, *forming)
+			forming = nil
+		}
+	}
+	return
+}
+
+func checkResampled(t *testing.T, env *BarEnv, expects []Kline) {
+	if env.Close.Len() != len(expects) {
+		t.Fatalf("expect %d bars, got %d", len(expects), env.Close.Len())
+	}
+	num := len(expects)
+	for i, k := range expects {
+		j := num - i - 1
+		if !equalNearly(env.Open.Get(j), k.Open) || !equalNearly(env.High.Get(j), k.High) ||
+			!equalNearly(env.Low.Get(j), k.Low) || !equalNearly(env.Close.Get(j), k.Close) ||
+			!equalNearly(env.Volume.Get(j), k.Volume) {
+			t.Fatalf("bar %d mismatch, expect %v", i, k)
+		}
+	}
+	if env.TimeStart != expects[num-1].Time || env.TimeStop != expects[num-1].Time+env.TFMSecs {
+		t.Errorf("bad bar time: %d - %d", env.TimeStart, env.TimeStop)
+	}
+}
+
+func TestResample(t *testing.T) {
+	base, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	env3d, err := base.Resample("3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same, _ := base.Resample("3d"); same != env3d {
+		t.Error("Resample should return the same env for same timeframe")
+	}
+	if _, err = base.Resample("12h"); err == nil {
+		t.Error("expect error for lower timeframe")
+	}
+	var smaVals []float64
+	RunFakeEnv(base, DataKline, func(i int, k Kline) {
+		if env3d.Close != nil {
+			smaVals = append(smaVals, SMA(env3d.Close, 3).Get(0))
+		}
+	})
+	expects, forming := aggBars(DataKline, env3d.TFMSecs, base.TFMSecs)
+	checkResampled(t, env3d, expects)
+	cur := env3d.FormingBar()
+	if (forming == nil) != (cur == nil) || (cur != nil && (cur.Time != forming.Time || !equalNearly(cur.Close, forming.Close))) {
+		t.Errorf("forming bar mismatch: %v %v", cur, forming)
+	}
+	if len(smaVals) == 0 {
+		t.Error("indicators should work on resampled env")
+	}
+}
+
+func TestResampleMissing(t *testing.T) {
+	base, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1h")
+	env4h, _ := base.Resample("4h")
+	var klines []Kline
+	for i, k := range DataKline[:17] {
+		// 从01:00开始，缺少08:00和15:00的K线
+		if i == 7 || i == 14 {
+			continue
+		}
+		k.Time = 1688169600000 + int64(i+1)*3600000
+		klines = append(klines, k)
+	}
+	for _, k := range klines {
+		if err := base.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expects, _ := aggBars(klines, env4h.TFMSecs, base.TFMSecs)
+	if len(expects) != 3 || expects[1].Open != DataKline[8].Open {
+		t.Fatalf("bad expects: %v", expects)
+	}
+	checkResampled(t, env4h, expects)
+}
+
+func TestResampleIntrabar(t *testing.T) {
+	base, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	env3d, _ := base.Resample("3d")
+	for _, k := range DataKline {
+		if err := base.OnBarUpdate(k.Time, k.Open, k.Open, k.Open, k.Open, 1, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := base.OnBarUpdate(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expects, _ := aggBars(DataKline, env3d.TFMSecs, base.TFMSecs)
+	checkResampled(t, env3d, expects)
+}
+
+func TestSecurity(t *testing.T) {
+	base, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	env3d, _ := base.Resample("3d")
+	type barVal struct {
+		start, stop int64
+		val         float64
+	}
+	var hist []barVal
+	findVal := func(match func(b barVal) bool) float64 {
+		for i := len(hist) - 1; i >= 0; i-- {
+			if match(hist[i]) {
+				return hist[i].val
+			}
+		}
+		return math.NaN()
+	}
+	RunFakeEnv(base, DataKline, func(i int, k Kline) {
+		if env3d.Close == nil {
+			return
+		}
+		ma := SMA(env3d.Close, 2)
+		if len(hist) == 0 || hist[len(hist)-1].start != env3d.TimeStart {
+			hist = append(hist, barVal{env3d.TimeStart, env3d.TimeStop, ma.Get(0)})
+		}
+		closed := Security(ma, base, SecLastClosed).Get(0)
+		expect := findVal(func(b barVal) bool { return b.stop <= base.TimeStop })
+		if !equalNearly(closed, expect) {
+			t.Fatalf("bar %d last closed: expect %v, got %v", i, expect, closed)
+		}
+		// 指标在未完成的大周期K线上没有值，使用最近完成的
+		forming := Security(ma, base, SecForming).Get(0)
+		expect = findVal(func(b barVal) bool { return b.start <= base.TimeStart })
+		if !equalNearly(forming, expect) {
+			t.Fatalf("bar %d forming: expect %v, got %v", i, expect, forming)
+		}
+		// OHLCV使用正在形成的K线
+		start, high := env3d.Frame.BarStart(k.Time), math.Inf(-1)
+		for j := i; j >= 0 && DataKline[j].Time >= start; j-- {
+			high = max(high, DataKline[j].High)
+		}
+		if val := Security(env3d.Close, base, SecForming).Get(0); val != k.Close {
+			t.Fatalf("bar %d forming close: expect %v, got %v", i, k.Close, val)
+		}
+		if val := Security(env3d.High, base, SecForming).Get(0); val != high {
+			t.Fatalf("bar %d forming high: expect %v, got %v", i, high, val)
+		}
+	})
+	// 名称相同的两个env不共用缓存
+	srcA, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	srcB, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	dst, _ := NewBarEnv("binance", "spot", "ETH/USDT", "1d")
+	for _, k := range DataKline[:5] {
+		srcA.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		srcB.OnBar(k.Time, k.Open, k.High, k.Low, k.Close*2, k.Volume, k.Info)
+		dst.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		valA := Security(srcA.Close, dst, SecLastClosed).Get(0)
+		valB := Security(srcB.Close, dst, SecLastClosed).Get(0)
+		if valA != k.Close || valB != k.Close*2 {
+			t.Fatalf("bar %d: expect %v, %v from envs with same name, got %v, %v", k.Time, k.Close, k.Close*2, valA, valB)
+		}
+	}
+}
@@ -10,7 +10,7 @@ import (
 AvgPrice typical price=(h+l+c)/3
 */
 func AvgPrice(e *BarEnv) *Series {
-	res := e.Close.To("_avgp", 0)
+	res := e.Close.ToKey(Key("_avgp"))
 	if res.Cached() {
 		return res
 	}
@@ -24,7 +24,7 @@ func AvgPrice(e *BarEnv) *Series {
 }
 
 func HL2(h, l *Series) *Series {
-	res := l.To("_hl", 0)
+	res := l.ToKey(Key("_hl", h))
 	if res.Cached() {
 		return res
 	}
@@ -39,7 +39,7 @@ func HL2(h, l *Series) *Series {
 
 // HLC3 typical price=(h+l+c)/3
 func HLC3(h, l, c *Series) *Series {
-	res := c.To("_hlc3", 0)
+	res := c.ToKey(Key("_hlc3", h, l))
 	if res.Cached() {
 		return res
 	}
@@ -56,8 +56,12 @@ type sumState struct {
 	arr    []float64
 }
 
+func (s *sumState) clone() moreState {
+	return &sumState{s.sumVal, append([]float64{}, s.arr...)}
+}
+
 func Sum(obj *Series, period int) *Series {
-	res := obj.To("_sum", period)
+	res := obj.ToKey(Key("_sum", period))
 	if res.Cached() {
 		return res
 	}
@@ -67,10 +71,7 @@ func Sum(obj *Series, period int) *Series {
 		if sta == nil {
 			sta = &sumState{}
 			res.More = sta
-			res.DupMore = func(more interface{}) interface{} {
-				s := more.(*sumState)
-				return &sumState{s.sumVal, append([]float64{}, s.arr...)}
-			}
+			res.DupMore = dupMoreState
 		}
 		curVal := obj.Get(0)
 		if !math.IsNaN(curVal) {
@@ -94,7 +95,7 @@ func Sum(obj *Series, period int) *Series {
 }
 
 func SMA(obj *Series, period int) *Series {
-	res := obj.To("_sma", period)
+	res := obj.ToKey(Key("_sma", period))
 	if res.Cached() {
 		return res
 	}
@@ -118,6 +119,10 @@ type moreVWMA struct {
 	volumes []float64
 }
 
+func (m *moreVWMA) clone() moreState {
+	return &moreVWMA{m.sumCost, m.sumWei, append([]float64{}, m.costs...), append([]float64{}, m.volumes...)}
+}
+
 /*
 VWMA Volume Weighted Moving Average 成交量加权平均价格
 
@@ -126,47 +131,48 @@ sum(price*volume)/sum(volume)
 suggest period: 20
 */
 func VWMA(price *Series, vol *Series, period int) *Series {
-	res := price.To("_vwma", period)
+	res := price.ToKey(Key("_vwma", vol, period))
 	if res.Cached() {
 		return res
 	}
 	res.LockData.Lock()
 	if !res.Cached() {
 		volVal := vol.Get(0)
-		cost := price.Get(0) * volVal
-		more, _ := res.More.(*moreVWMA)
-		if more == nil {
-			more = &moreVWMA{}
-			res.More = more
-			res.DupMore = func(mAny interface{}) interface{} {
-				m := mAny.(*moreVWMA)
-				return &moreVWMA{m.sumCost, m.sumWei, append([]float64{}, m.costs...), append([]float64{}, m.volumes...)}
-			}
-		}
-		if math.IsNaN(cost) {
-			res.Append(math.NaN())
-		} else {
-			more.sumCost += cost
-			more.sumWei += volVal
-			more.volumes = append(more.volumes, volVal)
-			more.costs = append(more.costs, cost)
-			if len(more.volumes) > period {
-				more.sumCost -= more.costs[0]
-				more.sumWei -= more.volumes[0]
-				more.costs = more.costs[1:]
-				more.volumes = more.volumes[1:]
-			}
-			if len(more.volumes) < period {
-				res.Append(math.NaN())
-			} else {
-				res.Append(more.sumCost / more.sumWei)
-			}
-		}
+		sumRatio(res, price.Get(0)*volVal, volVal, period)
 	}
 	res.LockData.Unlock()
 	return res
 }
 
+// sumRatio append sum(num, period) / sum(den, period) to res, bars with NaN are skipped
+func sumRatio(res *Series, num, den float64, period int) {
+	more, _ := res.More.(*moreVWMA)
+	if more == nil {
+		more = &moreVWMA{}
+		res.More = more
+		res.DupMore = dupMoreState
+	}
+	if math.IsNaN(num) || math.IsNaN(den) {
+		res.Append(math.NaN())
+		return
+	}
+	more.sumCost += num
+	more.sumWei += den
+	more.volumes = append(more.volumes, den)
+	more.costs = append(more.costs, num)
+	if len(more.volumes) > period {
+		more.sumCost -= more.costs[0]
+		more.sumWei -= more.volumes[0]
+		more.costs = more.costs[1:]
+		more.volumes = more.volumes[1:]
+	}
+	if len(more.volumes) < period {
+		res.Append(math.NaN())
+	} else {
+		res.Append(more.sumCost / more.sumWei)
+	}
+}
+
 /*
 alpha: update weight for latest value
 initType: 0: sma   1: first value
@@ -230,7 +236,7 @@ EMABy 指数移动均线
 initType：0使用SMA初始化，1第一个有效值初始化
 */
 func EMABy(obj *Series, period int, initType int) *Series {
-	res := obj.To("_ema", period*10+initType)
+	res := obj.ToKey(Key("_ema", period, initType))
 	alpha := 2.0 / float64(period+1)
 	return ewma(obj, res, period, alpha, initType, math.NaN())
 }
@@ -266,11 +272,7 @@ initType：0使用SMA初始化，1第一个有效值初始化
 initVal 默认Nan
 */
 func RMABy(obj *Series, period int, initType int, initVal float64) *Series {
-	hash := period*1000 + initType*100
-	if !math.IsNaN(initVal) {
-		hash += int(initVal)
-	}
-	res := obj.To("_rma", hash)
+	res := obj.ToKey(Key("_rma", period, initType, initVal))
 	alpha := 1.0 / float64(period)
 	return ewma(obj, res, period, alpha, initType, initVal)
 }
@@ -281,6 +283,10 @@ type wmaSta struct {
 	weiSum float64
 }
 
+func (m *wmaSta) clone() moreState {
+	return &wmaSta{append([]float64{}, m.arr...), m.allSum, m.weiSum}
+}
+
 /*
 WMA Weighted Moving Average.
 
@@ -289,7 +295,7 @@ the weighting factors decrease in arithmetic progression.
 suggest period: 9
 */
 func WMA(obj *Series, period int) *Series {
-	res := obj.To("_wma", period)
+	res := obj.ToKey(Key("_wma", period))
 	if res.Cached() {
 		return res
 	}
@@ -303,10 +309,7 @@ func WMA(obj *Series, period int) *Series {
 			if more == nil {
 				more = &wmaSta{}
 				res.More = more
-				res.DupMore = func(mAny interface{}) interface{} {
-					m := mAny.(*wmaSta)
-					return &wmaSta{append([]float64{}, m.arr...), m.allSum, m.weiSum}
-				}
+				res.DupMore = dupMoreState
 			}
 			more.arr = append(more.arr, val)
 			if len(more.arr) > period {
@@ -336,7 +339,7 @@ suggest period: 9
 */
 func HMA(obj *Series, period int) *Series {
 	maLen := int(math.Floor(math.Sqrt(float64(period))))
-	mid := obj.To("_hmamid", period)
+	mid := obj.ToKey(Key("_hmamid", period))
 	if mid.Cached() {
 		return WMA(mid, maLen)
 	}
@@ -351,7 +354,7 @@ func HMA(obj *Series, period int) *Series {
 }
 
 func TR(high *Series, low *Series, close *Series) *Series {
-	res := high.To("_tr", 0)
+	res := high.ToKey(Key("_tr", low, close))
 	if res.Cached() {
 		return res
 	}
@@ -400,7 +403,7 @@ func MACD(obj *Series, fast int, slow int, smooth int) (*Series, *Series) {
 }
 
 func MACDBy(obj *Series, fast int, slow int, smooth int, initType int) (*Series, *Series) {
-	res := obj.To("_macd", fast*1000+slow*100+smooth*10+initType)
+	res := obj.ToKey(Key("_macd", fast, slow, smooth, initType))
 	if !res.Cached() {
 		res.LockData.Lock()
 		if !res.Cached() {
@@ -416,7 +419,7 @@ func MACDBy(obj *Series, fast int, slow int, smooth int, initType int) (*Series,
 }
 
 func rsiBy(obj *Series, period int, subVal float64) *Series {
-	res := obj.To("_rsi", period*100+int(subVal))
+	res := obj.ToKey(Key("_rsi", period, subVal))
 	if res.Cached() {
 		return res
 	}
@@ -434,9 +437,7 @@ func rsiBy(obj *Series, period int, subVal float64) *Series {
 				// 状态: [0:prevVal, 1:avgGain, 2:avgLoss, 3:validCount]
 				more = []float64{math.NaN(), 0, 0, 0}
 				res.More = more
-				res.DupMore = func(more interface{}) interface{} {
-					return append([]float64{}, more.([]float64)...)
-				}
+				res.DupMore = dupFloatArr
 			}
 
 			prevVal := more[0]
@@ -520,7 +521,7 @@ vtype: 0 Calculation in TradingView method
 	crsi = (rsi + ud + roc) / 3
 */
 func CRSIBy(obj *Series, period, upDn, roc, vtype int) *Series {
-	res := obj.To("_crsi", roc*100000+vtype*10000+upDn*100+period)
+	res := obj.ToKey(Key("_crsi", period, upDn, roc, vtype))
 	if res.Cached() {
 		return res
 	}
@@ -548,7 +549,7 @@ vtype: 0 TradingView (Count consecutive times)
 1 classic (abs count up to 1)
 */
 func UpDown(obj *Series, vtype int) *Series {
-	res := obj.To("_updn", vtype)
+	res := obj.ToKey(Key("_updn", vtype))
 	if res.Cached() {
 		return res
 	}
@@ -586,7 +587,7 @@ PercentRank
 calculates the percentile rank of a bar value in a data set.
 */
 func PercentRank(obj *Series, period int) *Series {
-	res := obj.To("_pecRk", period)
+	res := obj.ToKey(Key("_pecRk", period))
 	if res.Cached() {
 		return res
 	}
@@ -615,7 +616,7 @@ func PercentRank(obj *Series, period int) *Series {
 }
 
 func Highest(obj *Series, period int) *Series {
-	res := obj.To("_hh", period)
+	res := obj.ToKey(Key("_hh", period))
 	if res.Cached() {
 		return res
 	}
@@ -639,7 +640,7 @@ func Highest(obj *Series, period int) *Series {
 }
 
 func HighestBar(obj *Series, period int) *Series {
-	res := obj.To("_hhb", period)
+	res := obj.ToKey(Key("_hhb", period))
 	if res.Cached() {
 		return res
 	}
@@ -671,7 +672,7 @@ func HighestBar(obj *Series, period int) *Series {
 }
 
 func Lowest(obj *Series, period int) *Series {
-	res := obj.To("_ll", period)
+	res := obj.ToKey(Key("_ll", period))
 	if res.Cached() {
 		return res
 	}
@@ -695,7 +696,7 @@ func Lowest(obj *Series, period int) *Series {
 }
 
 func LowestBar(obj *Series, period int) *Series {
-	res := obj.To("_llb", period)
+	res := obj.ToKey(Key("_llb", period))
 	if res.Cached() {
 		return res
 	}
@@ -737,13 +738,6 @@ func KDJ(high *Series, low *Series, close *Series, period int, sm1 int, sm2 int)
 	return KDJBy(high, low, close, period, sm1, sm2, "rma")
 }
 
-var (
-	kdjTypes = map[string]int{
-		"rma": 1,
-		"sma": 2,
-	}
-)
-
 /*
 KDJBy alias: talib stoch indicator;
 
@@ -752,8 +746,7 @@ period: 9, sm1: 3, sm2: 3
 return (K, D, RSV)
 */
 func KDJBy(high *Series, low *Series, close *Series, period int, sm1 int, sm2 int, maBy string) (*Series, *Series, *Series) {
-	byVal, _ := kdjTypes[maBy]
-	res := high.To("_kdj", period*100000+sm1*1000+sm2*10+byVal)
+	res := high.ToKey(Key("_kdj", low, close, period, sm1, sm2, maBy))
 	if !res.Cached() {
 		res.LockData.Lock()
 		if !res.Cached() {
@@ -783,7 +776,7 @@ use KDJ if you want to apply SMA/RMA to this
 suggest period: 14
 */
 func Stoch(high, low, close *Series, period int) *Series {
-	res := high.To("_rsv", period)
+	res := high.ToKey(Key("_rsv", low, close, period))
 	if res.Cached() {
 		return res
 	}
@@ -817,7 +810,7 @@ Osc: AroonUp - AroonDn
 return [AroonUp, Osc, AroonDn]
 */
 func Aroon(high *Series, low *Series, period int) (*Series, *Series, *Series) {
-	res := high.To("_aroon", period)
+	res := high.ToKey(Key("_aroon", low, period))
 	if !res.Cached() {
 		res.LockData.Lock()
 		if !res.Cached() {
@@ -850,7 +843,7 @@ suggest period: 20
 return [stddev，sumVal]
 */
 func StdDevBy(obj *Series, period int, ddof int) (*Series, *Series) {
-	res := obj.To("_sdev", period*10+ddof)
+	res := obj.ToKey(Key("_sdev", period, ddof))
 	if !res.Cached() {
 		res.LockData.Lock()
 		if !res.Cached() {
@@ -882,9 +875,7 @@ func WrapFloatArr(res *Series, period int, inVal float64) []float64 {
 	var more []float64
 	if res.More == nil {
 		more = make([]float64, 0, period)
-		res.DupMore = func(more interface{}) interface{} {
-			return append([]float64{}, more.([]float64)...)
-		}
+		res.DupMore = dupFloatArr
 	} else {
 		more = res.More.([]float64)
 	}
@@ -906,7 +897,7 @@ period: 20, stdUp: 2, stdDn: 2
 return [upper, mid, lower]
 */
 func BBANDS(obj *Series, period int, stdUp, stdDn float64) (*Series, *Series, *Series) {
-	res := obj.To("_bb", period*10000+int(stdUp*1000)+int(stdDn*10))
+	res := obj.ToKey(Key("_bb", period, stdUp, stdDn))
 	if !res.Cached() {
 		res.LockData.Lock()
 		if !res.Cached() {
@@ -936,7 +927,7 @@ over sell: -9, -13
 9和13表示超买；-9和-13表示超卖
 */
 func TD(obj *Series) *Series {
-	res := obj.To("_td", 0)
+	res := obj.ToKey(Key("_td"))
 	if res.Cached() {
 		return res
 	}
@@ -1000,8 +991,8 @@ func ADXBy(high *Series, low *Series, close *Series, period, smoothing, method i
 		smoothing = period
 	}
 	// 初始化相关的系列
-	dx := plusDI.To("_dx", smoothing*10+method)
-	adx := plusDI.To("_adx", smoothing*10+method)
+	dx := plusDI.ToKey(Key("_dx", smoothing, method))
+	adx := plusDI.ToKey(Key("_adx", smoothing, method))
 	if adx.Cached() {
 		return adx
 	}
@@ -1036,6 +1027,10 @@ type dmState struct {
 	TRMA    float64 // 缓存TR的均值
 }
 
+func (m *dmState) clone() moreState {
+	return &dmState{m.Num, m.DmPosMA, m.DmNegMA, m.TRMA}
+}
+
 /*
 PluMinDI
 
@@ -1049,7 +1044,7 @@ func PluMinDI(high *Series, low *Series, close *Series, period int) (*Series, *S
 
 func pluMinDIBy(high *Series, low *Series, close *Series, period, method int) (*Series, *Series) {
 	plusDM, _ := pluMinDMBy(high, low, close, period, method)
-	res := plusDM.To("_PluMinDI", period*10+method)
+	res := plusDM.ToKey(Key("_PluMinDI", period, method))
 	if !res.Cached() {
 		res.LockData.Lock()
 		if !res.Cached() {
@@ -1089,7 +1084,7 @@ return [Plus DM, Minus DM]
 */
 func pluMinDMBy(high *Series, low *Series, close *Series, period, method int) (*Series, *Series) {
 	// 初始化相关的系列
-	res := close.To("_PluMinDM", period*10+method)
+	res := close.ToKey(Key("_PluMinDM", high, low, period, method))
 	if res.Cached() {
 		return res, res.Cols[0]
 	}
@@ -1111,10 +1106,7 @@ func pluMinDMBy(high *Series, low *Series, close *Series, period, method int) (*
 		if state == nil {
 			state = &dmState{}
 			res.More = state
-			res.DupMore = func(more interface{}) interface{} {
-				m := more.(*dmState)
-				return &dmState{m.Num, m.DmPosMA, m.DmNegMA, m.TRMA}
-			}
+			res.DupMore = dupMoreState
 		}
 		if math.IsNaN(tr) {
 			res.Append([]float64{math.NaN(), math.NaN()})
@@ -1154,7 +1146,7 @@ ROC rate of change
 suggest period: 9
 */
 func ROC(obj *Series, period int) *Series {
-	res := obj.To("_roc", period)
+	res := obj.ToKey(Key("_roc", period))
 	if res.Cached() {
 		return res
 	}
@@ -1162,9 +1154,7 @@ func ROC(obj *Series, period int) *Series {
 	if !res.Cached() {
 		prevs, ok := res.More.([]float64)
 		if !ok {
-			res.DupMore = func(more interface{}) interface{} {
-				return append([]float64{}, more.([]float64)...)
-			}
+			res.DupMore = dupFloatArr
 		}
 		curVal := obj.Get(0)
 		if math.IsNaN(curVal) {
@@ -1197,14 +1187,14 @@ func ROC(obj *Series, period int) *Series {
 
 // HeikinAshi return [open,high,low,close]
 func HeikinAshi(e *BarEnv) (*Series, *Series, *Series, *Series) {
-	res := e.Close.To("_heikin", 0)
+	res := e.Close.ToKey(Key("_heikin"))
 	if !res.Cached() {
 		res.LockData.Lock()
 		if !res.Cached() {
-			ho := e.Open.To("_hka", 0)
-			hh := e.High.To("_hka", 0)
-			hl := e.Low.To("_hka", 0)
-			hc := e.Close.To("_hka", 0)
+			ho := e.Open.ToKey(Key("_hka"))
+			hh := e.High.ToKey(Key("_hka"))
+			hl := e.Low.ToKey(Key("_hka"))
+			hc := e.Close.ToKey(Key("_hka"))
 
 			o, h, l, c := e.Open.Get(0), e.High.Get(0), e.Low.Get(0), e.Close.Get(0)
 
@@ -1235,13 +1225,17 @@ type tnrState struct {
 	arrIn  []float64
 }
 
+func (m *tnrState) clone() moreState {
+	return &tnrState{append([]float64{}, m.arr...), m.sumVal, m.prevIn, append([]float64{}, m.arrIn...)}
+}
+
 /*
 ER Efficiency Ratio / Trend to Noise Ratio
 
 suggest period: 8
 */
 func ER(obj *Series, period int) *Series {
-	res := obj.To("_tnr", period)
+	res := obj.ToKey(Key("_tnr", period))
 	if res.Cached() {
 		return res
 	}
@@ -1253,10 +1247,7 @@ func ER(obj *Series, period int) *Series {
 				prevIn: math.NaN(),
 			}
 			res.More = sta
-			res.DupMore = func(more interface{}) interface{} {
-				m := more.(*tnrState)
-				return &tnrState{append([]float64{}, m.arr...), m.sumVal, m.prevIn, append([]float64{}, m.arrIn...)}
-			}
+			res.DupMore = dupMoreState
 		}
 		inVal := obj.Get(0)
 		curVal := math.Abs(inVal - sta.prevIn)
@@ -1292,7 +1283,7 @@ func ER(obj *Series, period int) *Series {
 
 // AvgDev sum(abs(Vi - mean))/period
 func AvgDev(obj *Series, period int) *Series {
-	res := obj.To("_avgdev", period)
+	res := obj.ToKey(Key("_avgdev", period))
 	if res.Cached() {
 		return res
 	}
@@ -1331,7 +1322,7 @@ https://www.tradingview.com/support/solutions/43000502001-commodity-channel-inde
 suggest period: 20
 */
 func CCI(obj *Series, period int) *Series {
-	res := obj.To("_cci", period)
+	res := obj.ToKey(Key("_cci", period))
 	if res.Cached() {
 		return res
 	}
@@ -1372,6 +1363,10 @@ type cmfState struct {
 	sumVol   float64
 }
 
+func (m *cmfState) clone() moreState {
+	return &cmfState{append([]float64{}, m.mfSum...), append([]float64{}, m.volSum...), m.sumMfVal, m.sumVol}
+}
+
 /*
 CMF Chaikin Money Flow
 
@@ -1380,7 +1375,7 @@ https://www.tradingview.com/scripts/chaikinmoneyflow/?solution=43000501974
 suggest period: 20
 */
 func CMF(env *BarEnv, period int) *Series {
-	res := env.Close.To("_cmf", period)
+	res := env.Close.ToKey(Key("_cmf", period))
 	if res.Cached() {
 		return res
 	}
@@ -1393,10 +1388,7 @@ func CMF(env *BarEnv, period int) *Series {
 		if sta == nil {
 			sta = &cmfState{}
 			res.More = sta
-			res.DupMore = func(more interface{}) interface{} {
-				m := more.(*cmfState)
-				return &cmfState{append([]float64{}, m.mfSum...), append([]float64{}, m.volSum...), m.sumMfVal, m.sumVol}
-			}
+			res.DupMore = dupMoreState
 		}
 
 		var resVal = math.NaN()
@@ -1432,7 +1424,7 @@ func CMF(env *BarEnv, period int) *Series {
 
 // ADL Accumulation/Distribution Line
 func ADL(env *BarEnv) *Series {
-	adl := env.Close.To("_adl", 0)
+	adl := env.Close.ToKey(Key("_adl"))
 	if adl.Cached() {
 		return adl
 	}
@@ -1459,7 +1451,7 @@ https://www.tradingview.com/support/solutions/43000501979-chaikin-oscillator/
 short: 3, long: 10
 */
 func ChaikinOsc(env *BarEnv, shortLen int, longLen int) *Series {
-	res := env.Close.To("_chaikinosc", shortLen*1000+longLen)
+	res := env.Close.ToKey(Key("_chaikinosc", shortLen, longLen))
 	if res.Cached() {
 		return res
 	}
@@ -1492,7 +1484,7 @@ KAMABy Kaufman Adaptive Moving Average
 period: 10, fast: 2, slow: 30
 */
 func KAMABy(obj *Series, period int, fast, slow int) *Series {
-	res := obj.To("_kama", period*10000+slow*100+fast)
+	res := obj.ToKey(Key("_kama", period, fast, slow))
 	if res.Cached() {
 		return res
 	}
@@ -1528,7 +1520,7 @@ WillR William's Percent R
 suggest period: 14
 */
 func WillR(e *BarEnv, period int) *Series {
-	res := e.Close.To("_williams_r", period)
+	res := e.Close.ToKey(Key("_williams_r", period))
 	if res.Cached() {
 		return res
 	}
@@ -1555,7 +1547,7 @@ rsiLen: 14, stochLen: 14, maK: 3, maD: 3
 return [fastK, fastD]
 */
 func StochRSI(obj *Series, rsiLen int, stochLen int, maK int, maD int) (*Series, *Series) {
-	res := obj.To("_stoch_rsi", rsiLen*100000+stochLen*1000+maK*10+maD)
+	res := obj.ToKey(Key("_stoch_rsi", rsiLen, stochLen, maK, maD))
 	if !res.Cached() {
 		res.LockData.Lock()
 		if !res.Cached() {
@@ -1578,6 +1570,10 @@ type mfiState struct {
 	prev   float64
 }
 
+func (m *mfiState) clone() moreState {
+	return &mfiState{append([]float64{}, m.posArr...), append([]float64{}, m.negArr...), m.sumPos, m.sumNeg, m.prev}
+}
+
 /*
 MFI Money Flow Index
 
@@ -1586,7 +1582,7 @@ https://corporatefinanceinstitute.com/resources/career-map/sell-side/capital-mar
 suggest period: 14
 */
 func MFI(e *BarEnv, period int) *Series {
-	res := e.Close.To("_mfi", period)
+	res := e.Close.ToKey(Key("_mfi", period))
 	if res.Cached() {
 		return res
 	}
@@ -1596,10 +1592,7 @@ func MFI(e *BarEnv, period int) *Series {
 		if sta == nil {
 			sta = &mfiState{sumNeg: math.NaN(), sumPos: math.NaN(), prev: math.NaN()}
 			res.More = sta
-			res.DupMore = func(more interface{}) interface{} {
-				m := more.(*mfiState)
-				return &mfiState{append([]float64{}, m.posArr...), append([]float64{}, m.negArr...), m.sumPos, m.sumNeg, m.prev}
-			}
+			res.DupMore = dupMoreState
 		}
 		avgPrice := AvgPrice(e)
 		price0 := avgPrice.Get(0)
@@ -1656,14 +1649,14 @@ https://theforexgeek.com/relative-momentum-index/
 period: 14, montLen: 3
 */
 func RMI(obj *Series, period int, montLen int) *Series {
-	res := obj.To("_rmi", period*1000+montLen)
+	res := obj.ToKey(Key("_rmi", period, montLen))
 	if res.Cached() {
 		return res
 	}
 	res.LockData.Lock()
 	if !res.Cached() {
-		maxChg := obj.To("_max_chg", montLen)
-		minChg := obj.To("_min_chg", montLen)
+		maxChg := obj.ToKey(Key("_max_chg", montLen))
+		minChg := obj.ToKey(Key("_min_chg", montLen))
 		inVal := obj.Get(0)
 		if math.IsNaN(inVal) {
 			maxChg.Append(math.NaN())
@@ -1697,16 +1690,6 @@ func RMI(obj *Series, period int, montLen int) *Series {
 	return res
 }
 
-func boolToHash(vals ...bool) int {
-	result := 0
-	for i, v := range vals {
-		if v {
-			result += 1 << i
-		}
-	}
-	return result
-}
-
 /*
 LinReg Linear Regression Moving Average
 
@@ -1719,8 +1702,7 @@ func LinReg(obj *Series, period int) *Series {
 }
 
 func LinRegAdv(obj *Series, period int, angle, intercept, degrees, r, slope, tsf bool) *Series {
-	hash := period*100 + boolToHash(angle, intercept, degrees, r, slope, tsf)
-	res := obj.To("_linreg", hash)
+	res := obj.ToKey(Key("_linreg", period, angle, intercept, degrees, r, slope, tsf))
 	if res.Cached() {
 		return res
 	}
@@ -1809,6 +1791,10 @@ type cmdSta struct {
 	prevIn float64
 }
 
+func (m *cmdSta) clone() moreState {
+	return &cmdSta{append([]float64{}, m.subs...), m.sumPos, m.sumNeg, m.prevIn}
+}
+
 /*
 CMO Chande Momentum Oscillator
 
@@ -1829,7 +1815,7 @@ suggest period: 9
 maType: 0: ta-lib   1: tradingView
 */
 func CMOBy(obj *Series, period int, maType int) *Series {
-	res := obj.To("_cmo", period*10+maType)
+	res := obj.ToKey(Key("_cmo", period, maType))
 	if res.Cached() {
 		return res
 	}
@@ -1841,10 +1827,7 @@ func CMOBy(obj *Series, period int, maType int) *Series {
 				prevIn: math.NaN(),
 			}
 			res.More = sta
-			res.DupMore = func(more interface{}) interface{} {
-				m := more.(*cmdSta)
-				return &cmdSta{append([]float64{}, m.subs...), m.sumPos, m.sumNeg, m.prevIn}
-			}
+			res.DupMore = dupMoreState
 		}
 		inVal := obj.Get(0)
 		val := inVal - sta.prevIn
@@ -1917,7 +1900,7 @@ higher values equal more choppiness, while lower values indicate directional tre
 值越高，波动性越大，而值越低，则表示有方向性趋势。
 */
 func CHOP(e *BarEnv, period int) *Series {
-	res := e.Close.To("_chop", period)
+	res := e.Close.ToKey(Key("_chop", period))
 	if res.Cached() {
 		return res
 	}
@@ -1943,7 +1926,7 @@ sigma: Smoothing value. Default 6.0
 distOff: min 0 (smoother), max 1 (more responsive). Default: 0.85
 */
 func ALMA(obj *Series, period int, sigma, distOff float64) *Series {
-	res := obj.To("_alma", period*1000+int(sigma*100+distOff*100))
+	res := obj.ToKey(Key("_alma", period, sigma, distOff))
 	if res.Cached() {
 		return res
 	}
@@ -1980,7 +1963,7 @@ Stiffness Indicator
 maLen: 100, stiffLen: 60, stiffMa: 3
 */
 func Stiffness(obj *Series, maLen, stiffLen, stiffMa int) *Series {
-	bound := obj.To("_sti_bound", maLen)
+	bound := obj.ToKey(Key("_sti_bound", maLen))
 	if !bound.Cached() {
 		bound.LockData.Lock()
 		if !bound.Cached() {
@@ -1989,7 +1972,7 @@ func Stiffness(obj *Series, maLen, stiffLen, stiffMa int) *Series {
 		}
 		bound.LockData.Unlock()
 	}
-	above := bound.To("_raw_gt", stiffLen)
+	above := bound.ToKey(Key("_raw_gt", stiffLen))
 	if !above.Cached() {
 		above.LockData.Lock()
 		if !above.Cached() {
@@ -2014,6 +1997,10 @@ type dv2Sta struct {
 	dv  []float64
 }
 
+func (m *dv2Sta) clone() moreState {
+	return &dv2Sta{append([]float64{}, m.chl...), append([]float64{}, m.dv...)}
+}
+
 /*
 DV2 Developed by David Varadi of http://cssanalytics.wordpress.com/
 
@@ -2028,7 +2015,7 @@ DV2 Developed by David Varadi of http://cssanalytics.wordpress.com/
 	  - https://www.reddit.com/r/CapitalistExploits/comments/1d0azms/david_varadis_dv2_indicator_trading_strategies/
 */
 func DV2(h, l, c *Series, period, maLen int) *Series {
-	res := c.To("_dv", period*100+maLen)
+	res := c.ToKey(Key("_dv", h, l, period, maLen))
 	if res.Cached() {
 		return res
 	}
@@ -2038,10 +2025,7 @@ func DV2(h, l, c *Series, period, maLen int) *Series {
 		if sta == nil {
 			sta = &dv2Sta{}
 			res.More = sta
-			res.DupMore = func(more interface{}) interface{} {
-				m := more.(*dv2Sta)
-				return &dv2Sta{append([]float64{}, m.chl...), append([]float64{}, m.dv...)}
-			}
+			res.DupMore = dupMoreState
 		}
 		h0, l0, c0 := h.Get(0), l.Get(0), c.Get(0)
 		// 如果当前输入值为 NaN，返回NaN然后跳过，不重置状态
@@ -2101,7 +2085,7 @@ func DV2(h, l, c *Series, period, maLen int) *Series {
 UTBot UT Bot Alerts from TradingView
 */
 func UTBot(c, atr *Series, rate float64) *Series {
-	res := atr.To("_utBot", int(rate*10))
+	res := atr.ToKey(Key("_utBot", c, rate))
 	if res.Cached() {
 		return res
 	}
@@ -2187,6 +2171,10 @@ type stcSta struct {
 	prevSTC float64   // 前周期最终STC值
 }
 
+func (m *stcSta) clone() moreState {
+	return &stcSta{append([]float64{}, m.macdHis...), append([]float64{}, m.dddHis...), m.prevDDD, m.prevSTC}
+}
+
 /*
 STC colored indicator
 
@@ -2195,7 +2183,7 @@ period: 12  fast: 26  slow: 50  alpha: 0.5
 https://www.tradingview.com/u/shayankm/
 */
 func STC(obj *Series, period, fast, slow int, alpha float64) *Series {
-	res := obj.To("_stc", fast*10000+slow*100+period)
+	res := obj.ToKey(Key("_stc", period, fast, slow, alpha))
 	if res.Cached() {
 		return res
 	}
@@ -2208,10 +2196,7 @@ func STC(obj *Series, period, fast, slow int, alpha float64) *Series {
 				prevSTC: math.NaN(),
 			}
 			res.More = s
-			res.DupMore = func(more interface{}) interface{} {
-				m := more.(*stcSta)
-				return &stcSta{append([]float64{}, m.macdHis...), append([]float64{}, m.dddHis...), m.prevDDD, m.prevSTC}
-			}
+			res.DupMore = dupMoreState
 		}
 		// 1. 计算MACD差值
 		fastEMA := EMA(obj, fast).Get(0)
@@ -2263,3 +2248,215 @@ func STC(obj *Series, period, fast, slow int, alpha float64) *Series {
 	res.LockData.Unlock()
 	return res
 }
+
+/*
+BarsSince number of bars since cond was non-zero last time, 0 if cond is non-zero on current bar,
+NaN before the first time. NaN values of cond are skipped and not counted, same as Sum.
+
+距离上次cond非0的bar数，当前bar满足时为0，首次满足前为NaN。cond为NaN时跳过且不计数
+*/
+func BarsSince(cond *Series) *Series {
+	res := cond.ToKey(Key("_barsSince"))
+	if res.Cached() {
+		return res
+	}
+	res.LockData.Lock()
+	if !res.Cached() {
+		num, ok := res.More.(float64)
+		if !ok {
+			num = math.NaN()
+		}
+		flag := cond.Get(0)
+		if math.IsNaN(flag) {
+			res.Append(math.NaN())
+		} else {
+			if flag != 0 {
+				num = 0
+			} else if !math.IsNaN(num) {
+				num += 1
+			}
+			res.More = num
+			res.Append(num)
+		}
+	}
+	res.LockData.Unlock()
+	return res
+}
+
+/*
+ValueWhen value of src when cond was non-zero, occurrence 0 for the latest time, 1 for the one before, etc.
+NaN if not enough occurrences or cond is NaN.
+
+cond非0时src的值，occurrence为0表示最近一次，1表示倒数第二次，次数不足或cond为NaN时返回NaN
+*/
+func ValueWhen(cond, src *Series, occurrence int) *Series {
+	res := cond.ToKey(Key("_valueWhen", src, occurrence))
+	if res.Cached() {
+		return res
+	}
+	res.LockData.Lock()
+	if !res.Cached() {
+		vals, _ := res.More.([]float64)
+		flag := cond.Get(0)
+		if math.IsNaN(flag) {
+			res.Append(math.NaN())
+		} else {
+			if flag != 0 {
+				vals = append(vals, src.Get(0))
+				if len(vals) > occurrence+1 {
+					vals = vals[1:]
+				}
+				res.More = vals
+				res.DupMore = dupFloatArr
+			}
+			if len(vals) > occurrence {
+				res.Append(vals[len(vals)-1-occurrence])
+			} else {
+				res.Append(math.NaN())
+			}
+		}
+	}
+	res.LockData.Unlock()
+	return res
+}
+
+// windowFlag compare current value with previous period values, NaN values are skipped
+func windowFlag(obj *Series, key ParamKey, period int, calc func(arr []float64) float64) *Series {
+	res := obj.ToKey(key)
+	if res.Cached() {
+		return res
+	}
+	res.LockData.Lock()
+	if !res.Cached() {
+		curVal := obj.Get(0)
+		if math.IsNaN(curVal) {
+			res.Append(math.NaN())
+		} else {
+			arr := WrapFloatArr(res, period+1, curVal)
+			if len(arr) > period {
+				res.Append(calc(arr))
+			} else {
+				res.Append(math.NaN())
+			}
+		}
+	}
+	res.LockData.Unlock()
+	return res
+}
+
+func isRising(arr []float64) float64 {
+	cur := arr[len(arr)-1]
+	for _, v := range arr[:len(arr)-1] {
+		if cur <= v {
+			return 0
+		}
+	}
+	return 1
+}
+
+func isFalling(arr []float64) float64 {
+	cur := arr[len(arr)-1]
+	for _, v := range arr[:len(arr)-1] {
+		if cur >= v {
+			return 0
+		}
+	}
+	return 1
+}
+
+/*
+Rising 1 if current value is greater than each of the previous period values, else 0
+
+当前值大于前period个值时为1，否则为0
+*/
+func Rising(obj *Series, period int) *Series {
+	return windowFlag(obj, Key("_rising", period), period, isRising)
+}
+
+/*
+Falling 1 if current value is less than each of the previous period values, else 0
+
+当前值小于前period个值时为1，否则为0
+*/
+func Falling(obj *Series, period int) *Series {
+	return windowFlag(obj, Key("_falling", period), period, isFalling)
+}
+
+/*
+Change difference between current value and the value period bars ago
+
+当前值与period个bar之前的值的差
+*/
+func Change(obj *Series, period int) *Series {
+	return windowFlag(obj, Key("_change", period), period, func(arr []float64) float64 {
+		return arr[len(arr)-1] - arr[0]
+	})
+}
+
+/*
+CVD Cumulative Volume Delta, cumulative sum of buy volume minus sell volume (Volume - BuyVolume).
+Extended fields are required, see BarEnv.OnKline
+
+累计成交量差：主动买入量减主动卖出量（Volume - BuyVolume）的累加，需通过BarEnv.OnKline传入扩展字段
+*/
+func CVD(env *BarEnv) *Series {
+	res := env.Close.ToKey(Key("_cvd"))
+	if res.Cached() {
+		return res
+	}
+	res.LockData.Lock()
+	if !res.Cached() {
+		env.enableExt()
+		delta := 2*env.BuyVolume.Get(0) - env.Volume.Get(0)
+		if math.IsNaN(delta) {
+			res.Append(math.NaN())
+		} else {
+			sumVal, _ := res.More.(float64)
+			sumVal += delta
+			res.More = sumVal
+			res.Append(sumVal)
+		}
+	}
+	res.LockData.Unlock()
+	return res
+}
+
+/*
+QVWAP Volume Weighted Average Price by quote volume, sum(QuoteVolume, period) / sum(Volume, period).
+It's the exact average price when period is 1. Extended fields are required, see BarEnv.OnKline
+
+按成交额计算的精确成交量加权均价，period为1时即K线的成交均价。需通过BarEnv.OnKline传入扩展字段
+*/
+func QVWAP(env *BarEnv, period int) *Series {
+	res := env.Close.ToKey(Key("_qvwap", period))
+	if res.Cached() {
+		return res
+	}
+	res.LockData.Lock()
+	if !res.Cached() {
+		env.enableExt()
+		sumRatio(res, env.QuoteVolume.Get(0), env.Volume.Get(0), period)
+	}
+	res.LockData.Unlock()
+	return res
+}
+
+/*
+AvgTradeSize average volume per trade, sum(Volume, period) / sum(TradeNum, period).
+Extended fields are required, see BarEnv.OnKline
+
+平均每笔成交量，需通过BarEnv.OnKline传入扩展字段
+*/
+func AvgTradeSize(env *BarEnv, period int) *Series {
+	res := env.Close.ToKey(Key("_avgtrade", period))
+	if res.Cached() {
+		return res
+	}
+	res.LockData.Lock()
+	if !res.Cached() {
+		env.enableExt()
+		sumRatio(res, env.Volume.Get(0), env.TradeNum.Get(0), period)
+	}
+	res.LockData.Unlock()
+	return res
+}
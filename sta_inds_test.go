@@ -64,6 +64,11 @@ func getTestCases() []CaseItem {
 	UTBotArr := []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), 0, 0, 0, -1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, -1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
 	stcArr := []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), 0, 0, 50, 75, 87.5, 93.75, 96.875, 53.315953688832515, 60.892293944128326, 30.446146972064163, 15.223073486032082, 7.611536743016041, 3.8057683715080204, 1.9028841857540102, 50.95144209287701, 75.47572104643851, 87.73786052321925, 93.86893026160962, 96.93446513080481, 48.467232565402405, 24.233616282701202, 13.694685116631517, 56.84734255831576, 78.42367127915787, 89.21183563957894, 94.60591781978947, 92.71405758734181, 96.3570287936709, 48.17851439683545, 24.089257198417727, 12.044628599208863, 6.022314299604432, 53.011157149802216, 76.50557857490111, 88.25278928745055, 94.12639464372528, 52.69324668529326, 26.34662334264663, 13.173311671323315, 6.586655835661658, 35.19523085928331, 29.536743561548136, 14.768371780774068, 7.384185890387034, 3.692092945193517, 51.846046472596754, 75.92302323629838, 87.96151161814919, 93.9807558090746, 96.9903779045373, 98.49518895226865, 99.24759447613432, 99.62379723806717, 99.81189861903358}
 	crossArr := []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4, 5, 6, -1, -2, -3, -4, -5, -6, -7, 1, -1, -2, -3, -4, -5, 1, 2, -1, 1, 2, 3, -1, -2, -3, -4, 1, 2, 3, 4, -1, -2, -3, -4, -5, -6, -7, -8, -9, -10, -11, 1, 2, 3, -1, -2}
+	barsSinceArr := []float64{0, 0, 0, 1, 2, 3, 0, 1, 2, 0, 0, 1, 0, 1, 2, 3, 4, 5, 0, 1, 0, 1, 0, 1, 0, 0, 1, 0, 0, 1, 2, 0, 1, 0, 1, 2, 0, 0, 0, 1, 2, 3, 0, 1, 0, 1, 2, 3, 4, 0, 0, 1, 2, 0, 1, 2, 3, 0}
+	valueWhenArr := []float64{math.NaN(), 30573.6, 30612.7, 30612.7, 30612.7, 30612.7, 31149, 31149, 31149, 30327.9, 30396.9, 30396.9, 30608.4, 30608.4, 30608.4, 30608.4, 30608.4, 30608.4, 31441.7, 31441.7, 29895.5, 29895.5, 29891.4, 29891.4, 30070.8, 29216.3, 29216.3, 29336, 29299.9, 29299.9, 29299.9, 29339.1, 29339.1, 29701.2, 29701.2, 29701.2, 29180.2, 29075.9, 29202.7, 29202.7, 29202.7, 29202.7, 29759, 29759, 29420.7, 29420.7, 29420.7, 29420.7, 29420.7, 29419.5, 26088.3, 26088.3, 26088.3, 26175.9, 26175.9, 26175.9, 26175.9, 26419.2}
+	risingArr := []float64{math.NaN(), math.NaN(), 1, 0, 0, 0, 0, 0, 0, 1, 1, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 0, 0, 0, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 0, 0, 0, 1}
+	fallingArr := []float64{math.NaN(), math.NaN(), 0, 0, 1, 1, 0, 0, 1, 0, 0, 1, 0, 1, 1, 1, 1, 1, 0, 1, 0, 1, 0, 1, 0, 0, 1, 0, 0, 1, 1, 0, 1, 0, 1, 1, 0, 0, 0, 0, 1, 1, 0, 1, 0, 1, 1, 1, 1, 0, 0, 0, 1, 0, 0, 1, 1, 0}
+	changeArr := []float64{math.NaN(), math.NaN(), math.NaN(), 182.5, -124.29999999999927, -1274.5999999999985, -428.1999999999971, -219.10000000000218, 273.3999999999978, 69, 339.1000000000022, 221.10000000000218, 1044.7999999999993, -315.1000000000022, -92.5, -1224.9000000000015, -167.20000000000073, -430.8000000000029, -321.2999999999993, -335.09999999999854, 45.80000000000291, -112, 279.7999999999993, -727.6000000000022, -567.2000000000007, -734.7999999999993, 45.900000000001455, 83.60000000000218, 3.099999999998545, 61.39999999999782, -79.10000000000218, 362.1000000000022, -101, -40.599999999998545, -600.1000000000022, -112.39999999999782, -104.29999999999927, 101.60000000000218, 701.2999999999993, 496.8999999999978, 241, -343.5, -152.09999999999854, -150.40000000000146, 4, -231.90000000000146, -578.8999999999978, -2809.7999999999993, -3146.7000000000007, -2626.100000000002, -433.7999999999993, 73.30000000000291, -43.89999999999782, 243.29999999999927, 49.19999999999709, 7.299999999999272, -414.90000000000146, -76.89999999999782}
 	return []CaseItem{
 		{"sum", sumArr, func(o, h, l, c, v, i []float64) []float64 {
 			return tav.Sum(c, 9)
@@ -374,7 +379,41 @@ func getTestCases() []CaseItem {
 			xFlag := Cross(ma1, ma2)
 			return float64(xFlag)
 		}},
+		{"BarsSince", barsSinceArr, func(o, h, l, c, v, i []float64) []float64 {
+			return tav.BarsSince(upFlags(o, c))
+		}, func(env *BarEnv) float64 {
+			return BarsSince(Greater(env.Close, env.Open)).Get(0)
+		}},
+		{"ValueWhen", valueWhenArr, func(o, h, l, c, v, i []float64) []float64 {
+			return tav.ValueWhen(upFlags(o, c), c, 1)
+		}, func(env *BarEnv) float64 {
+			return ValueWhen(Greater(env.Close, env.Open), env.Close, 1).Get(0)
+		}},
+		{"Rising", risingArr, func(o, h, l, c, v, i []float64) []float64 {
+			return tav.Rising(c, 2)
+		}, func(env *BarEnv) float64 {
+			return Rising(env.Close, 2).Get(0)
+		}},
+		{"Falling", fallingArr, func(o, h, l, c, v, i []float64) []float64 {
+			return tav.Falling(c, 2)
+		}, func(env *BarEnv) float64 {
+			return Falling(env.Close, 2).Get(0)
+		}},
+		{"Change", changeArr, func(o, h, l, c, v, i []float64) []float64 {
+			return tav.Change(c, 3)
+		}, func(env *BarEnv) float64 {
+			return Change(env.Close, 3).Get(0)
+		}},
+	}
+}
+
+// upFlags 1 if close > open, NaN if any is NaN
+func upFlags(o, c []float64) []float64 {
+	res := make([]float64, len(c))
+	for i := range c {
+		res[i] = opGreater(c[i], o[i])
 	}
+	return res
 }
 
 func TestCommon(t *testing.T) {
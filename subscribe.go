@@ -0,0 +1,188 @@
+package banta
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+/*
+IndSub an indicator subscription which is computed automatically on every bar by OnBar,
+and computed again after OnBarUpdate. So stateful indicators never miss bars no matter which code paths run.
+
+订阅的指标，每个bar由OnBar自动计算，OnBarUpdate后也会重新计算，无论策略走哪个分支都不会漏算
+*/
+type IndSub struct {
+	Name   string
+	Deps   []string                       // 依赖的其他订阅名，需先订阅，计算时在此之前
+	Calc   func(e *BarEnv) []*Series      // 计算指标，返回的序列可通过SubResult获取
+	OnCalc func(e *BarEnv, res []*Series) // 可选，每次计算后回调
+}
+
+type envSub struct {
+	*IndSub
+	ind *IndInfo // 通过SubscribeInd订阅时不为空
+	res []*Series
+}
+
+/*
+Subscribe register an indicator to be computed on every bar, in the order of subscribing.
+Dependencies must be subscribed before, so they are always computed first.
+Return error wrapping ErrInvalidSub for empty or duplicate names and unknown dependencies.
+
+订阅指标，每个bar按订阅顺序计算；依赖需先订阅，从而总是先计算。名称为空或重复、依赖不存在时返回ErrInvalidSub
+*/
+func (e *BarEnv) Subscribe(sub *IndSub) error {
+	return e.addSub(sub, nil)
+}
+
+func (e *BarEnv) addSub(sub *IndSub, ind *IndInfo) error {
+	if sub.Name == "" || sub.Calc == nil {
+		return fmt.Errorf("%w: name and Calc are required", ErrInvalidSub)
+	}
+	e.lockSubs.Lock()
+	defer e.lockSubs.Unlock()
+	if e.findSub(sub.Name) >= 0 {
+		return fmt.Errorf("%w: duplicate %s", ErrInvalidSub, sub.Name)
+	}
+	for _, dep := range sub.Deps {
+		if e.findSub(dep) < 0 {
+			return fmt.Errorf("%w: %s depends on unknown %s", ErrInvalidSub, sub.Name, dep)
+		}
+	}
+	e.subs = append(e.subs, &envSub{IndSub: sub, ind: ind})
+	return nil
+}
+
+/*
+SubscribeInd subscribe an indicator in registry by name. inputs can be ohlcv names, or other subscriptions
+as "name" (first output) or "name.output", missing inputs are read from BarEnv.
+params missing at the end use defaults.
+
+按名称订阅注册的指标。inputs可以是ohlcv字段名，或其他订阅"name"（第一个输出）、"name.output"，
+为空时从BarEnv读取。params末尾缺少的使用默认值
+*/
+func (e *BarEnv) SubscribeInd(name, indName string, inputs []string, params []float64,
+	cb func(e *BarEnv, res []*Series)) error {
+	ind := GetIndicator(indName)
+	if ind == nil {
+		return fmt.Errorf("%w: unknown indicator %s", ErrInvalidSub, indName)
+	}
+	params, err := ind.CheckArgs(params)
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 || ind.UseEnv {
+		inputs = ind.Inputs
+	} else if len(inputs) != len(ind.Inputs) {
+		return fmt.Errorf("%w: %s expects %d inputs, got %d", ErrInvalidSub, indName, len(ind.Inputs), len(inputs))
+	}
+	var deps []string
+	getIns := make([]func(e *BarEnv) *Series, len(inputs))
+	for i, text := range inputs {
+		if exprVars[text] {
+			getIns[i] = func(e *BarEnv) *Series {
+				return e.varSeries(text)
+			}
+			continue
+		}
+		dep, out, _ := strings.Cut(text, ".")
+		col := 0
+		if out != "" {
+			depSub := e.getSub(dep)
+			if depSub == nil {
+				return fmt.Errorf("%w: %s depends on unknown %s", ErrInvalidSub, name, dep)
+			}
+			col = slices.Index(depSub.outputs(), out)
+			if col < 0 {
+				return fmt.Errorf("%w: %s has no output %s", ErrInvalidSub, dep, out)
+			}
+		}
+		deps = append(deps, dep)
+		getIns[i] = func(e *BarEnv) *Series {
+			return e.SubResult(dep)[col]
+		}
+	}
+	return e.addSub(&IndSub{
+		Name: name,
+		Deps: deps,
+		Calc: func(e *BarEnv) []*Series {
+			ins := make([]*Series, len(getIns))
+			for i, get := range getIns {
+				ins[i] = get(e)
+			}
+			return ind.call(e, ins, params)
+		},
+		OnCalc: cb,
+	}, ind)
+}
+
+// Unsubscribe remove a subscription, fail if other subscriptions depend on it
+func (e *BarEnv) Unsubscribe(name string) error {
+	e.lockSubs.Lock()
+	defer e.lockSubs.Unlock()
+	idx := e.findSub(name)
+	if idx < 0 {
+		return fmt.Errorf("%w: unknown %s", ErrInvalidSub, name)
+	}
+	for _, s := range e.subs {
+		if slices.Contains(s.Deps, name) {
+			return fmt.Errorf("%w: %s is required by %s", ErrInvalidSub, name, s.Name)
+		}
+	}
+	e.subs = slices.Delete(e.subs, idx, idx+1)
+	return nil
+}
+
+/*
+SubResult return the Series computed on current bar for a subscription, nil if not found or not computed yet
+
+返回订阅在当前bar计算的序列，不存在或尚未计算时返回nil
+*/
+func (e *BarEnv) SubResult(name string) []*Series {
+	e.lockSubs.Lock()
+	defer e.lockSubs.Unlock()
+	if idx := e.findSub(name); idx >= 0 {
+		return e.subs[idx].res
+	}
+	return nil
+}
+
+func (e *BarEnv) findSub(name string) int {
+	return slices.IndexFunc(e.subs, func(s *envSub) bool {
+		return s.Name == name
+	})
+}
+
+func (e *BarEnv) getSub(name string) *envSub {
+	e.lockSubs.Lock()
+	defer e.lockSubs.Unlock()
+	if idx := e.findSub(name); idx >= 0 {
+		return e.subs[idx]
+	}
+	return nil
+}
+
+// outputs names of results, only known for indicators in registry
+func (s *envSub) outputs() []string {
+	if s.ind == nil {
+		return nil
+	}
+	return s.ind.Outputs
+}
+
+// calcSubs compute all subscriptions on current bar
+func (e *BarEnv) calcSubs() {
+	e.lockSubs.Lock()
+	subs := slices.Clone(e.subs)
+	e.lockSubs.Unlock()
+	for _, s := range subs {
+		res := s.Calc(e)
+		e.lockSubs.Lock()
+		s.res = res
+		e.lockSubs.Unlock()
+		if s.OnCalc != nil {
+			s.OnCalc(e, res)
+		}
+	}
+}
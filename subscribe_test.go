@@ -0,0 +1,97 @@
+package banta
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/banbox/banta/tav"
+)
+
+func TestSubscribe(t *testing.T) {
+	_, h, l, c, _, _ := extractOHLCV(DataKline)
+	ema := tav.EMA(c, 5)
+	sig := tav.SMA(ema, 3)
+	_, kd, _ := tav.KDJ(h, l, c, 9, 3, 3)
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	calcNum := 0
+	if err := env.SubscribeInd("fast", "EMA", nil, []float64{5}, nil); err != nil {
+		t.Fatal(err)
+	}
+	err := env.SubscribeInd("sig", "SMA", []string{"fast"}, []float64{3}, func(e *BarEnv, res []*Series) {
+		calcNum += 1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = env.SubscribeInd("kdj", "KDJ", nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = env.SubscribeInd("kd", "SMA", []string{"kdj.d"}, []float64{1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	bads := []error{
+		env.SubscribeInd("fast", "EMA", nil, nil, nil),
+		env.SubscribeInd("x", "FOO", nil, nil, nil),
+		env.SubscribeInd("x", "SMA", []string{"slow"}, nil, nil),
+		env.SubscribeInd("x", "SMA", []string{"kdj.j"}, nil, nil),
+		env.Subscribe(&IndSub{Name: "x", Deps: []string{"slow"}, Calc: func(e *BarEnv) []*Series { return nil }}),
+		env.Unsubscribe("fast"),
+	}
+	for i, err := range bads {
+		if !errors.Is(err, ErrInvalidSub) {
+			t.Errorf("case %d: expect ErrInvalidSub, got %v", i, err)
+		}
+	}
+	RunFakeEnv(env, DataKline, func(i int, k Kline) {
+		// 只在部分bar读取，订阅的指标仍每个bar计算
+		if i%3 != 0 {
+			return
+		}
+		if val := env.SubResult("fast")[0].Get(0); !equalNearly(val, ema[i]) {
+			t.Fatalf("bar %d: fast expect %v, got %v", i, ema[i], val)
+		}
+		if val := env.SubResult("sig")[0].Get(0); !equalNearly(val, sig[i]) {
+			t.Fatalf("bar %d: sig expect %v, got %v", i, sig[i], val)
+		}
+		if val := env.SubResult("kd")[0].Get(0); !equalNearly(val, kd[i]) {
+			t.Fatalf("bar %d: kd expect %v, got %v", i, kd[i], val)
+		}
+	})
+	if calcNum != len(DataKline) {
+		t.Errorf("expect %d callbacks, got %d", len(DataKline), calcNum)
+	}
+	if err = env.Unsubscribe("sig"); err != nil {
+		t.Error(err)
+	}
+	if err = env.Unsubscribe("fast"); err != nil {
+		t.Error(err)
+	}
+	if env.SubResult("fast") != nil {
+		t.Error("expect nil result after unsubscribe")
+	}
+}
+
+func TestSubscribeUpdate(t *testing.T) {
+	_, _, _, c, _, _ := extractOHLCV(DataKline)
+	expects := tav.EMA(c, 5)
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	var last float64
+	err := env.SubscribeInd("ema", "EMA", nil, []float64{5}, func(e *BarEnv, res []*Series) {
+		last = res[0].Get(0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, k := range DataKline {
+		err = env.OnBarUpdate(k.Time, k.Open, k.Open, k.Open, k.Open, 0, 0)
+		if err == nil {
+			err = env.OnBarUpdate(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalNearly(last, expects[i]) {
+			t.Fatalf("bar %d: expect %v, got %v", i, expects[i], last)
+		}
+	}
+}
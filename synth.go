@@ -0,0 +1,222 @@
+package banta
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// policies when the bar of one leg is late for synthetic env
+const (
+	SynthWait   = iota // 等待两腿同一时间的K线都到达后生成，一腿缺失的bar跳过
+	SynthFill          // 两腿K线都到达后生成；一腿越过另一腿缺失的bar时，缺失的腿使用其最近K线填充，迟到的K线忽略
+	SynthUpdate        // 任一腿到达新bar时立即生成，另一腿使用其最近K线；迟到的K线到达时通过OnBarUpdate更新合成的K线
+)
+
+// synth build bars of a synthetic env from two legs, aligned on TimeStart
+type synth struct {
+	env    *BarEnv
+	legs   [2]*BarEnv
+	last   [2]*Kline   // 各腿最近的K线
+	pend   [2][]*Kline // SynthWait和SynthFill下等待另一腿的K线
+	calc   func(a, b float64) float64
+	policy int
+	lock   sync.Mutex
+}
+
+/*
+NewSynthEnv create a BarEnv whose bars are derived from two legs with calc, such as a ratio or a spread,
+and updated automatically as both legs receive bars. All indicators can run on it.
+
+Open/High/Low/Close are computed from the same fields of two legs, then High/Low are adjusted to contain
+Open and Close. Volume is taken from leg a, Info is NaN.
+policy decides what to do when the bar of one leg is late: SynthWait, SynthFill, SynthUpdate.
+With SynthFill a bar is generated once both legs arrive, a missing bar of one leg is only filled by its
+latest bar when the other leg moves past it, so the order of legs doesn't change results.
+
+从两个品种合成BarEnv，如比率或价差，两腿收到K线时自动更新，可在其上运行所有指标。
+开高低收由两腿对应字段计算，再调整高低价包含开收盘价；成交量取a腿，Info为NaN。policy决定一腿K线迟到时的处理方式。
+SynthFill在两腿K线都到达后生成，一腿越过另一腿缺失的bar时才使用缺失腿的最近K线填充，结果和两腿到达顺序无关
+*/
+func NewSynthEnv(symbol string, a, b *BarEnv, calc func(a, b float64) float64, policy int) (*BarEnv, error) {
+	if a.TimeFrame != b.TimeFrame {
+		return nil, fmt.Errorf("legs of synthetic env should have same timeframe, got %s, %s",
+			a.TimeFrame, b.TimeFrame)
+	}
+	frame := a.Frame
+	if frame == nil {
+		var err error
+		if frame, err = ParseTFrame(a.TimeFrame); err != nil {
+			return nil, err
+		}
+	}
+	env := NewBarEnvIn(a.Exchange, a.MarketType, symbol, frame)
+	env.MaxCache = a.MaxCache
+	env.Intrabar = policy == SynthUpdate
+	s := &synth{env: env, legs: [2]*BarEnv{a, b}, calc: calc, policy: policy}
+	for _, leg := range s.legs {
+		leg.lockListen.Lock()
+		leg.listeners = append(leg.listeners, s)
+		leg.lockListen.Unlock()
+	}
+	return env, nil
+}
+
+/*
+RatioEnv create a synthetic BarEnv of a / b, see NewSynthEnv
+
+创建a / b的合成BarEnv
+*/
+func RatioEnv(a, b *BarEnv, policy int) (*BarEnv, error) {
+	return NewSynthEnv(a.Symbol+"/"+b.Symbol, a, b, opDiv, policy)
+}
+
+/*
+SpreadEnv create a synthetic BarEnv of wa * a - wb * b, see NewSynthEnv
+
+创建wa * a - wb * b的合成BarEnv
+*/
+func SpreadEnv(a, b *BarEnv, wa, wb float64, policy int) (*BarEnv, error) {
+	symbol := fmt.Sprintf("%v*%s-%v*%s", wa, a.Symbol, wb, b.Symbol)
+	return NewSynthEnv(symbol, a, b, func(x, y float64) float64 {
+		return wa*x - wb*y
+	}, policy)
+}
+
+func (s *synth) legIdx(src *BarEnv) int {
+	if src == s.legs[0] {
+		return 0
+	}
+	return 1
+}
+
+func (s *synth) onSrcBar(src *BarEnv, bar *Kline, endMS int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	i := s.legIdx(src)
+	if s.policy == SynthFill {
+		s.onFill(i, bar)
+		return
+	}
+	s.last[i] = bar
+	if s.policy == SynthUpdate {
+		if bar.Time > s.env.TimeStart && s.last[1-i] != nil {
+			s.emit(bar.Time, endMS)
+		} else if bar.Time == s.env.TimeStart {
+			// 迟到的K线，更新合成的K线
+			s.update()
+		}
+		return
+	}
+	other := s.pend[1-i]
+	for len(other) > 0 && other[0].Time < bar.Time {
+		// 另一腿中当前腿缺失的bar
+		other = other[1:]
+	}
+	s.pend[1-i] = other
+	if len(other) == 0 {
+		s.pend[i] = append(s.pend[i], bar)
+		if over := len(s.pend[i]) - max(s.env.MaxCache, 1); over > 0 {
+			s.pend[i] = s.pend[i][over:]
+		}
+		return
+	}
+	if other[0].Time == bar.Time {
+		s.pend[1-i] = other[1:]
+		s.last[1-i] = other[0]
+		s.emit(bar.Time, endMS)
+	}
+	// 另一腿已越过此bar时，丢弃
+}
+
+// onFill generate bars for SynthFill, a bar is generated when both legs arrive, or filled with the latest bar
+// of the lagging leg when the leading leg moves past it
+func (s *synth) onFill(i int, bar *Kline) {
+	if s.env.Close != nil && bar.Time <= s.env.TimeStart {
+		// 迟到的K线忽略
+		return
+	}
+	// 另一腿等待中的早于bar的K线，当前腿缺失，使用当前腿之前的K线填充
+	other := s.pend[1-i]
+	for len(other) > 0 && other[0].Time < bar.Time {
+		s.fill(1-i, other[0])
+		other = other[1:]
+	}
+	s.pend[1-i] = other
+	// 当前腿已越过等待中的K线，另一腿缺失这些bar
+	for _, k := range s.pend[i] {
+		s.fill(i, k)
+	}
+	s.pend[i] = nil
+	if len(other) > 0 && other[0].Time == bar.Time {
+		s.last[i], s.last[1-i] = bar, other[0]
+		s.pend[1-i] = other[1:]
+		s.emit(bar.Time, s.env.barEnd(bar.Time))
+		return
+	}
+	s.pend[i] = append(s.pend[i], bar)
+}
+
+// fill generate the bar of leg i, using the latest bar of the other leg
+func (s *synth) fill(i int, bar *Kline) {
+	s.last[i] = bar
+	if s.last[1-i] != nil {
+		s.emit(bar.Time, s.env.barEnd(bar.Time))
+	}
+}
+
+func (s *synth) onSrcUpdate(src *BarEnv, bar *Kline) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	i := s.legIdx(src)
+	if s.policy != SynthUpdate {
+		for j, b := range s.pend[i] {
+			if b.Time == bar.Time {
+				s.pend[i][j] = bar
+			}
+		}
+	}
+	if s.last[i] != nil && s.last[i].Time == bar.Time {
+		s.last[i] = bar
+	}
+	if bar.Time != s.env.TimeStart || !s.env.Intrabar {
+		return nil
+	}
+	return s.update()
+}
+
+// bar compute the synthetic bar from the latest bars of two legs
+func (s *synth) bar() Kline {
+	a, b := s.last[0], s.last[1]
+	o := s.calc(a.Open, b.Open)
+	c := s.calc(a.Close, b.Close)
+	return Kline{
+		Open:   o,
+		High:   max(s.calc(a.High, b.High), o, c),
+		Low:    min(s.calc(a.Low, b.Low), o, c),
+		Close:  c,
+		Volume: a.Volume,
+		Info:   math.NaN(),
+	}
+}
+
+func (s *synth) emit(barMS, endMS int64) {
+	b := s.bar()
+	s.env.OnBar2(barMS, endMS, b.Open, b.High, b.Low, b.Close, b.Volume, b.Info)
+}
+
+func (s *synth) update() error {
+	if s.last[0] == nil || s.last[1] == nil {
+		return nil
+	}
+	b := s.bar()
+	return s.env.OnBarUpdate(s.env.TimeStart, b.Open, b.High, b.Low, b.Close, b.Volume, b.Info)
+}
+
+func (s *synth) reset() {
+	s.lock.Lock()
+	s.last = [2]*Kline{}
+	s.pend = [2][]*Kline{}
+	s.env.Reset()
+	s.lock.Unlock()
+}
@@ -0,0 +1,136 @@
+package banta
+
+import (
+	"testing"
+
+	"github.com/banbox/banta/tav"
+)
+
+// synthLegs return bars of two legs, leg b misses the bar at missIdx
+func synthLegs(missIdx int) ([]Kline, []Kline) {
+	legB := make([]Kline, 0, len(DataKline))
+	for i, k := range DataKline {
+		if i == missIdx {
+			continue
+		}
+		add := float64(i)
+		k.Open, k.High, k.Low, k.Close = k.Open/20+add, k.High/20+add, k.Low/20+add, k.Close/20+add
+		legB = append(legB, k)
+	}
+	return DataKline, legB
+}
+
+func TestSynthEnv(t *testing.T) {
+	const missIdx = 20
+	legA, legB := synthLegs(missIdx)
+	for _, policy := range []int{SynthWait, SynthFill, SynthUpdate} {
+		a, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+		b, _ := NewBarEnv("binance", "spot", "ETH/USDT", "1d")
+		env, err := RatioEnv(a, b, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var closes, expects, fills, mids []float64
+		var lastB *Kline
+		j := 0
+		for _, k := range legA {
+			// a腿先到达，b腿迟到
+			a.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+			if policy == SynthUpdate && lastB != nil {
+				// 立即以b腿上一个K线合成
+				if env.TimeStart != k.Time || !equalNearly(env.Close.Get(0), k.Close/lastB.Close) {
+					t.Fatalf("policy %d bar %d: expect filled bar, got %v", policy, k.Time, env.Close.Get(0))
+				}
+			} else if env.Close != nil && env.TimeStart == k.Time {
+				t.Fatalf("policy %d bar %d: expect waiting for leg b", policy, k.Time)
+			}
+			if j < len(legB) && legB[j].Time == k.Time {
+				kb := legB[j]
+				b.OnBar(kb.Time, kb.Open, kb.High, kb.Low, kb.Close, kb.Volume, kb.Info)
+				lastB = &legB[j]
+				j++
+			} else if policy != SynthUpdate && env.TimeStart == k.Time {
+				t.Fatalf("policy %d bar %d: expect not generated as leg b missing", policy, k.Time)
+			}
+			// b腿缺失时使用其上一个K线
+			fills = append(fills, k.Close/lastB.Close)
+			if env.TimeStart != k.Time {
+				continue
+			}
+			closes = append(closes, env.Close.Get(0))
+			expects = append(expects, k.Close/lastB.Close)
+			_, mid, _ := BBANDS(env.Close, 5, 2, 2)
+			mids = append(mids, mid.Get(0))
+			if env.High.Get(0) < max(env.Open.Get(0), env.Close.Get(0)) ||
+				env.Low.Get(0) > min(env.Open.Get(0), env.Close.Get(0)) {
+				t.Fatalf("policy %d bar %d: bad high/low", policy, k.Time)
+			}
+		}
+		expNum := len(legA)
+		if policy == SynthWait {
+			expNum -= 1
+		}
+		if policy == SynthFill {
+			// 缺失的bar在a腿越过时填充，其他bar使用两腿同一时间的K线
+			if env.Close.Len() != len(fills) || len(closes) != len(fills)-1 {
+				t.Fatalf("fill: expect %d bars, got %d", len(fills), env.Close.Len())
+			}
+			for i, v := range fills {
+				if got := env.Close.Get(len(fills) - 1 - i); !equalNearly(got, v) {
+					t.Fatalf("fill bar %d: expect close %v, got %v", i, v, got)
+				}
+			}
+			continue
+		}
+		if len(closes) != expNum || env.Close.Len() != expNum {
+			t.Fatalf("policy %d: expect %d bars, got %d", policy, expNum, len(closes))
+		}
+		for i, v := range closes {
+			if !equalNearly(v, expects[i]) {
+				t.Fatalf("policy %d bar %d: expect close %v, got %v", policy, i, expects[i], v)
+			}
+		}
+		smas := tav.SMA(expects, 5)
+		for i, v := range mids {
+			if !equalNearly(v, smas[i]) {
+				t.Fatalf("policy %d bar %d: expect mid %v, got %v", policy, i, smas[i], v)
+			}
+		}
+	}
+	// SynthFill结果和两腿到达顺序无关
+	var envs []*BarEnv
+	for _, bFirst := range []bool{false, true} {
+		a, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+		b, _ := NewBarEnv("binance", "spot", "ETH/USDT", "1d")
+		env, _ := RatioEnv(a, b, SynthFill)
+		j := 0
+		for _, k := range legA {
+			var kb *Kline
+			if j < len(legB) && legB[j].Time == k.Time {
+				kb = &legB[j]
+				j++
+			}
+			if kb != nil && bFirst {
+				b.OnBar(kb.Time, kb.Open, kb.High, kb.Low, kb.Close, kb.Volume, kb.Info)
+			}
+			a.OnBar(k.Time, k.Open, k.High, k.Low, k.Close, k.Volume, k.Info)
+			if kb != nil && !bFirst {
+				b.OnBar(kb.Time, kb.Open, kb.High, kb.Low, kb.Close, kb.Volume, kb.Info)
+			}
+		}
+		envs = append(envs, env)
+	}
+	if envs[0].Close.Len() != envs[1].Close.Len() {
+		t.Fatalf("fill: expect same bars for any leg order, got %d, %d", envs[0].Close.Len(), envs[1].Close.Len())
+	}
+	for i := 0; i < envs[0].Close.Len(); i++ {
+		if !equalNearly(envs[0].Close.Get(i), envs[1].Close.Get(i)) {
+			t.Fatalf("fill bar %d: leg order changes close %v, %v", i, envs[0].Close.Get(i), envs[1].Close.Get(i))
+		}
+	}
+	a, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	b, _ := NewBarEnv("binance", "spot", "ETH/USDT", "1h")
+	if _, err := SpreadEnv(a, b, 1, 2, SynthWait); err == nil {
+		t.Error("expect error for different timeframes")
+	}
+}
@@ -2287,6 +2287,191 @@ func HeikinAshi(open, high, low, close []float64) ([]float64, []float64, []float
 	return hOpen, hHigh, hLow, hClose
 }
 
+/*
+BarsSince number of bars since cond was non-zero last time, 0 if cond is non-zero on current bar,
+NaN before the first time. NaN values of cond are skipped and not counted.
+
+距离上次cond非0的bar数，当前bar满足时为0，首次满足前为NaN。cond为NaN时跳过且不计数
+*/
+func BarsSince(cond []float64) []float64 {
+	res := make([]float64, len(cond))
+	num := math.NaN()
+	for i, flag := range cond {
+		if math.IsNaN(flag) {
+			res[i] = math.NaN()
+			continue
+		}
+		if flag != 0 {
+			num = 0
+		} else if !math.IsNaN(num) {
+			num += 1
+		}
+		res[i] = num
+	}
+	return res
+}
+
+/*
+ValueWhen value of src when cond was non-zero, occurrence 0 for the latest time, 1 for the one before, etc.
+NaN if not enough occurrences or cond is NaN.
+
+cond非0时src的值，occurrence为0表示最近一次，1表示倒数第二次，次数不足或cond为NaN时返回NaN
+*/
+func ValueWhen(cond, src []float64, occurrence int) []float64 {
+	res := make([]float64, len(cond))
+	var vals []float64
+	for i, flag := range cond {
+		if math.IsNaN(flag) {
+			res[i] = math.NaN()
+			continue
+		}
+		if flag != 0 {
+			vals = append(vals, src[i])
+		}
+		if len(vals) > occurrence {
+			res[i] = vals[len(vals)-1-occurrence]
+		} else {
+			res[i] = math.NaN()
+		}
+	}
+	return res
+}
+
+// windowCalc apply calc on the latest period+1 valid values, NaN values are skipped
+func windowCalc(data []float64, period int, calc func(arr []float64) float64) []float64 {
+	res := make([]float64, len(data))
+	arr := make([]float64, 0, period+1)
+	for i, v := range data {
+		if math.IsNaN(v) {
+			res[i] = math.NaN()
+			continue
+		}
+		arr = append(arr, v)
+		if len(arr) > period+1 {
+			arr = arr[1:]
+		}
+		if len(arr) > period {
+			res[i] = calc(arr)
+		} else {
+			res[i] = math.NaN()
+		}
+	}
+	return res
+}
+
+/*
+Rising 1 if current value is greater than each of the previous period values, else 0
+
+当前值大于前period个值时为1，否则为0
+*/
+func Rising(data []float64, period int) []float64 {
+	return windowCalc(data, period, func(arr []float64) float64 {
+		cur := arr[len(arr)-1]
+		for _, v := range arr[:len(arr)-1] {
+			if cur <= v {
+				return 0
+			}
+		}
+		return 1
+	})
+}
+
+/*
+Falling 1 if current value is less than each of the previous period values, else 0
+
+当前值小于前period个值时为1，否则为0
+*/
+func Falling(data []float64, period int) []float64 {
+	return windowCalc(data, period, func(arr []float64) float64 {
+		cur := arr[len(arr)-1]
+		for _, v := range arr[:len(arr)-1] {
+			if cur >= v {
+				return 0
+			}
+		}
+		return 1
+	})
+}
+
+/*
+Change difference between current value and the value period bars ago
+
+当前值与period个bar之前的值的差
+*/
+func Change(data []float64, period int) []float64 {
+	return windowCalc(data, period, func(arr []float64) float64 {
+		return arr[len(arr)-1] - arr[0]
+	})
+}
+
+/*
+CVD Cumulative Volume Delta, cumulative sum of buy volume minus sell volume (volume - buyVolume)
+
+累计成交量差：主动买入量减主动卖出量（volume - buyVolume）的累加
+*/
+func CVD(volume, buyVolume []float64) []float64 {
+	res := make([]float64, len(volume))
+	sum := 0.0
+	for i, v := range volume {
+		delta := 2*buyVolume[i] - v
+		if math.IsNaN(delta) {
+			res[i] = math.NaN()
+			continue
+		}
+		sum += delta
+		res[i] = sum
+	}
+	return res
+}
+
+/*
+QVWAP Volume Weighted Average Price by quote volume, sum(quoteVolume, period) / sum(volume, period)
+
+按成交额计算的精确成交量加权均价
+*/
+func QVWAP(quoteVolume, volume []float64, period int) []float64 {
+	return sumRatio(quoteVolume, volume, period)
+}
+
+/*
+AvgTradeSize average volume per trade, sum(volume, period) / sum(tradeNum, period)
+
+平均每笔成交量
+*/
+func AvgTradeSize(volume, tradeNum []float64, period int) []float64 {
+	return sumRatio(volume, tradeNum, period)
+}
+
+// sumRatio sum(num, period) / sum(den, period), bars with NaN are skipped
+func sumRatio(num, den []float64, period int) []float64 {
+	res := make([]float64, len(num))
+	var sumNum, sumDen float64
+	nums := make([]float64, 0, period+1)
+	dens := make([]float64, 0, period+1)
+	for i, v := range num {
+		if math.IsNaN(v) || math.IsNaN(den[i]) {
+			res[i] = math.NaN()
+			continue
+		}
+		sumNum += v
+		sumDen += den[i]
+		nums = append(nums, v)
+		dens = append(dens, den[i])
+		if len(nums) > period {
+			sumNum -= nums[0]
+			sumDen -= dens[0]
+			nums = nums[1:]
+			dens = dens[1:]
+		}
+		if len(nums) < period {
+			res[i] = math.NaN()
+		} else {
+			res[i] = sumNum / sumDen
+		}
+	}
+	return res
+}
+
 /*
 Cross 计算两个序列在每个时间点的交叉状态。
 返回值：正数表示上穿，负数表示下穿，0表示无交叉或未知。
@@ -0,0 +1,172 @@
+package banta
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/*
+TFrame timeframe which knows calendar months, quarters, years, week anchors and timezone.
+
+Loc: timezone for day and larger units, nil means UTC.
+Offset: session offset in milliseconds, the bar starts at Offset after local midnight.
+WeekStart: first day of week, time.Monday for ISO weeks, or time.Sunday.
+
+支持日历月/季/年、周起始日和时区的周期。Loc为时区，Offset为交易日开始相对当地零点的毫秒偏移
+*/
+type TFrame struct {
+	Name      string
+	Unit      byte  // s m h d w M q y
+	Num       int   // 单位数量
+	MSecs     int64 // 毫秒间隔，月/季/年为近似值
+	Loc       *time.Location
+	Offset    int64
+	WeekStart time.Weekday
+}
+
+// ParseTFrame parse timeframe like 1m, 4h, 1d, 1w, 1M, 1q, 1y, in UTC with ISO weeks
+func ParseTFrame(timeframe string) (*TFrame, error) {
+	secs, err := ParseTimeFrame(timeframe)
+	if err != nil {
+		return nil, err
+	}
+	num, _ := strconv.Atoi(timeframe[:len(timeframe)-1])
+	if num <= 0 {
+		return nil, fmt.Errorf("invalid timeframe: %s", timeframe)
+	}
+	unit := timeframe[len(timeframe)-1]
+	switch unit {
+	case 'Y':
+		unit = 'y'
+	case 'Q':
+		unit = 'q'
+	case 'W':
+		unit = 'w'
+	case 'D':
+		unit = 'd'
+	case 'H':
+		unit = 'h'
+	case 'S':
+		unit = 's'
+	}
+	return &TFrame{
+		Name:      timeframe,
+		Unit:      unit,
+		Num:       num,
+		MSecs:     int64(secs) * 1000,
+		WeekStart: time.Monday,
+	}, nil
+}
+
+// Derive create a new timeframe with same timezone, offset and week anchor
+func (t *TFrame) Derive(timeframe string) (*TFrame, error) {
+	res, err := ParseTFrame(timeframe)
+	if err != nil {
+		return nil, err
+	}
+	res.Loc = t.Loc
+	res.Offset = t.Offset
+	res.WeekStart = t.WeekStart
+	return res, nil
+}
+
+// IsCalendar whether bars have variable length, such as months, or days in timezone with daylight saving time
+func (t *TFrame) IsCalendar() bool {
+	switch t.Unit {
+	case 'M', 'q', 'y':
+		return true
+	case 'd', 'w':
+		return t.Loc != nil && t.Loc != time.UTC
+	}
+	return false
+}
+
+func (t *TFrame) loc() *time.Location {
+	if t.Loc == nil {
+		return time.UTC
+	}
+	return t.Loc
+}
+
+func (t *TFrame) months() int {
+	switch t.Unit {
+	case 'q':
+		return t.Num * 3
+	case 'y':
+		return t.Num * 12
+	}
+	return t.Num
+}
+
+func floorDiv(a, b int64) int64 {
+	res := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		res -= 1
+	}
+	return res
+}
+
+/*
+BarStart return the start time of bar which contains ms
+
+返回包含ms的bar的开始时间
+*/
+func (t *TFrame) BarStart(ms int64) int64 {
+	loc := t.loc()
+	if t.Unit == 's' || t.Unit == 'm' || t.Unit == 'h' {
+		_, zoneSecs := time.UnixMilli(ms).In(loc).Zone()
+		shift := int64(zoneSecs)*1000 - t.Offset
+		return floorDiv(ms+shift, t.MSecs)*t.MSecs - shift
+	}
+	local := time.UnixMilli(ms - t.Offset).In(loc)
+	y, m, d := local.Date()
+	var start time.Time
+	switch t.Unit {
+	case 'd', 'w':
+		// 自1970-01-01起的当地天数
+		days := floorDiv(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).UnixMilli(), SecsDay*1000)
+		if t.Unit == 'd' {
+			days = floorDiv(days, int64(t.Num)) * int64(t.Num)
+		} else {
+			// 1970-01-01是周四，找到其后第一个周起始日
+			anchor := int64((int(t.WeekStart) - int(time.Thursday) + 7) % 7)
+			weeks := floorDiv(days-anchor, 7)
+			days = anchor + floorDiv(weeks, int64(t.Num))*int64(t.Num)*7
+		}
+		dt := time.UnixMilli(days * SecsDay * 1000).UTC()
+		start = time.Date(dt.Year(), dt.Month(), dt.Day(), 0, 0, 0, 0, loc)
+	default:
+		months := int64(y)*12 + int64(m) - 1
+		months = floorDiv(months, int64(t.months())) * int64(t.months())
+		start = time.Date(int(months/12), time.Month(months%12+1), 1, 0, 0, 0, 0, loc)
+	}
+	return start.UnixMilli() + t.Offset
+}
+
+/*
+BarEnd return the end time (exclusive) of bar which starts at barMs
+
+返回从barMs开始的bar的结束时间（不含）
+*/
+func (t *TFrame) BarEnd(barMs int64) int64 {
+	if !t.IsCalendar() {
+		return barMs + t.MSecs
+	}
+	local := time.UnixMilli(barMs - t.Offset).In(t.loc())
+	var end time.Time
+	switch t.Unit {
+	case 'd':
+		end = local.AddDate(0, 0, t.Num)
+	case 'w':
+		end = local.AddDate(0, 0, t.Num*7)
+	default:
+		y, m, d := local.Date()
+		hour, minute, sec := local.Clock()
+		first := time.Date(y, m+time.Month(t.months()), 1, hour, minute, sec, local.Nanosecond(), local.Location())
+		// 避免1月31日加一个月变为3月
+		maxDay := time.Date(first.Year(), first.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		end = first.AddDate(0, 0, min(d, maxDay)-1)
+	}
+	return end.UnixMilli() + t.Offset
+}
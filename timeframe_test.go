@@ -0,0 +1,117 @@
+package banta
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTFrame(t *testing.T) {
+	ms := func(loc *time.Location, y int, m time.Month, d, h int) int64 {
+		return time.Date(y, m, d, h, 0, 0, 0, loc).UnixMilli()
+	}
+	utc := time.UTC
+	shanghai := time.FixedZone("UTC+8", 8*3600)
+	type tfCase struct {
+		tf    string
+		setup func(f *TFrame)
+		at    int64
+		start int64
+		end   int64
+	}
+	cases := []tfCase{
+		{"1h", nil, ms(utc, 2024, 3, 5, 7) + 1000, ms(utc, 2024, 3, 5, 7), ms(utc, 2024, 3, 5, 8)},
+		{"1d", nil, ms(utc, 2024, 3, 5, 7), ms(utc, 2024, 3, 5, 0), ms(utc, 2024, 3, 6, 0)},
+		{"1d", func(f *TFrame) { f.Loc = shanghai }, ms(utc, 2024, 3, 5, 20), ms(shanghai, 2024, 3, 6, 0), ms(shanghai, 2024, 3, 7, 0)},
+		{"1d", func(f *TFrame) { f.Offset = 17 * 3600 * 1000 }, ms(utc, 2024, 3, 5, 7), ms(utc, 2024, 3, 4, 17), ms(utc, 2024, 3, 5, 17)},
+		// 2024-03-06 is Wednesday
+		{"1w", nil, ms(utc, 2024, 3, 6, 7), ms(utc, 2024, 3, 4, 0), ms(utc, 2024, 3, 11, 0)},
+		{"1w", func(f *TFrame) { f.WeekStart = time.Sunday }, ms(utc, 2024, 3, 6, 7), ms(utc, 2024, 3, 3, 0), ms(utc, 2024, 3, 10, 0)},
+		{"1M", nil, ms(utc, 2024, 2, 29, 23), ms(utc, 2024, 2, 1, 0), ms(utc, 2024, 3, 1, 0)},
+		{"1M", func(f *TFrame) { f.Loc = shanghai }, ms(utc, 2024, 1, 31, 20), ms(shanghai, 2024, 2, 1, 0), ms(shanghai, 2024, 3, 1, 0)},
+		{"3M", nil, ms(utc, 2024, 5, 10, 0), ms(utc, 2024, 4, 1, 0), ms(utc, 2024, 7, 1, 0)},
+		{"1q", nil, ms(utc, 2024, 12, 31, 23), ms(utc, 2024, 10, 1, 0), ms(utc, 2025, 1, 1, 0)},
+		{"1y", nil, ms(utc, 2024, 7, 1, 0), ms(utc, 2024, 1, 1, 0), ms(utc, 2025, 1, 1, 0)},
+	}
+	if ny, err := time.LoadLocation("America/New_York"); err == nil {
+		// 2024-03-10 daylight saving time starts, the day has 23 hours
+		cases = append(cases, tfCase{"1d", func(f *TFrame) { f.Loc = ny }, ms(ny, 2024, 3, 10, 12),
+			ms(ny, 2024, 3, 10, 0), ms(ny, 2024, 3, 11, 0)})
+	}
+	for i, c := range cases {
+		f, err := ParseTFrame(c.tf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.setup != nil {
+			c.setup(f)
+		}
+		start := f.BarStart(c.at)
+		if start != c.start {
+			t.Errorf("case %d %s start: expect %v, got %v", i, c.tf, time.UnixMilli(c.start).UTC(), time.UnixMilli(start).UTC())
+		}
+		if end := f.BarEnd(start); end != c.end {
+			t.Errorf("case %d %s end: expect %v, got %v", i, c.tf, time.UnixMilli(c.end).UTC(), time.UnixMilli(end).UTC())
+		}
+	}
+	if _, err := ParseTFrame("0d"); err == nil {
+		t.Error("expect error for zero timeframe")
+	}
+}
+
+func TestResampleMonth(t *testing.T) {
+	base, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1d")
+	envMon, err := base.Resample("1M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expects []Kline
+	var forming *Kline
+	for _, k := range DataKline {
+		date := time.UnixMilli(k.Time).UTC()
+		if forming == nil || date.Day() == 1 {
+			bar := k
+			forming = &bar
+		} else {
+			forming.High = max(forming.High, k.High)
+			forming.Low = min(forming.Low, k.Low)
+			forming.Close = k.Close
+			forming.Volume += k.Volume
+		}
+		if date.AddDate(0, 0, 1).Day() == 1 {
+			expects = append(expects, *forming)
+			forming = nil
+		}
+	}
+	var closes []float64
+	RunFakeEnv(base, DataKline, func(i int, k Kline) {
+		if envMon.Close == nil {
+			closes = append(closes, math.NaN())
+			return
+		}
+		closes = append(closes, Security(envMon.Close, base, SecLastClosed).Get(0))
+	})
+	if envMon.Close.Len() != len(expects) {
+		t.Fatalf("expect %d bars, got %d", len(expects), envMon.Close.Len())
+	}
+	for i, k := range expects {
+		j := len(expects) - i - 1
+		if !equalNearly(envMon.High.Get(j), k.High) || !equalNearly(envMon.Close.Get(j), k.Close) ||
+			!equalNearly(envMon.Volume.Get(j), k.Volume) {
+			t.Fatalf("bar %d mismatch, expect %v", i, k)
+		}
+	}
+	last := expects[len(expects)-1]
+	if envMon.TimeStart != last.Time || envMon.TimeStop != time.UnixMilli(last.Time).UTC().AddDate(0, 1, 0).UnixMilli() {
+		t.Errorf("bad bar time: %d - %d", envMon.TimeStart, envMon.TimeStop)
+	}
+	// 每月最后一天收盘后才能看到当月K线
+	for i, k := range DataKline {
+		date := time.UnixMilli(k.Time).UTC()
+		if date.AddDate(0, 0, 1).Day() == 1 && date.Month() == time.UnixMilli(last.Time).UTC().Month() {
+			if !equalNearly(closes[i], last.Close) {
+				t.Errorf("bar %d security close: expect %v, got %v", i, last.Close, closes[i])
+			}
+		}
+	}
+}
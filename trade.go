@@ -0,0 +1,148 @@
+package banta
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Trade a single trade from exchange
+type Trade struct {
+	Time  int64 // 成交时间，毫秒
+	Price float64
+	Size  float64
+	IsBuy bool // 是否主动买入
+}
+
+/*
+TradeAgg aggregate trades into time bars of Env. A bar is sent by OnBar2 when a trade of a later bar arrives,
+or Flush is called after its end. Volume of taker buy trades is saved to BuyVolume, sell volume is
+Volume - BuyVolume. Bars without trades are flat at the last close with zero volume, unless SkipEmpty is set.
+
+With Intrabar, Env is updated by OnKlineUpdate on every trade, and the bar is added when its first trade arrives.
+
+将逐笔成交聚合为Env周期的K线。后续bar的成交到达或调用Flush时，通过OnBar2发送已完成的K线。
+主动买入量记录在BuyVolume，卖出量为Volume - BuyVolume。无成交的bar以上一收盘价生成成交量为0的K线，设置SkipEmpty时跳过。
+开启Intrabar时每笔成交通过OnKlineUpdate实时更新Env，bar在首笔成交时添加
+*/
+type TradeAgg struct {
+	Env       *BarEnv
+	Intrabar  bool // 每笔成交实时更新Env的当前bar
+	SkipEmpty bool // 不生成无成交的bar
+	bar       Kline
+	stop      int64 // 最近一个bar的结束时间
+	active    bool  // 是否有正在形成的bar
+	lock      sync.Mutex
+}
+
+/*
+NewTradeAgg create a trade aggregator for env, set intrabar to update env on every trade
+
+为env创建逐笔成交聚合器，intrabar为true时每笔成交实时更新env
+*/
+func NewTradeAgg(env *BarEnv, intrabar bool) *TradeAgg {
+	if intrabar {
+		env.Intrabar = true
+	}
+	return &TradeAgg{Env: env, Intrabar: intrabar}
+}
+
+/*
+OnTrade add a trade, trades should be in time order.
+
+添加一笔成交，成交需按时间顺序
+*/
+func (a *TradeAgg) OnTrade(tr *Trade) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	e := a.Env
+	if a.active && tr.Time >= a.bar.Time && tr.Time < a.stop {
+		b := &a.bar
+		b.High = max(b.High, tr.Price)
+		b.Low = min(b.Low, tr.Price)
+		b.Close = tr.Price
+		a.addSize(tr)
+	} else if tr.Time < a.stop {
+		return fmt.Errorf("%s/%s old Trade: %d, Current: %d", e.Symbol, e.TimeFrame, tr.Time, a.stop)
+	} else {
+		a.closeTo(tr.Time)
+		start := e.barStart(tr.Time)
+		a.bar = Kline{Time: start, Open: tr.Price, High: tr.Price, Low: tr.Price, Close: tr.Price,
+			Info: math.NaN()}
+		a.addSize(tr)
+		a.stop = e.barEnd(start)
+		a.active = true
+	}
+	if a.Intrabar {
+		bar := a.bar
+		return e.OnKlineUpdate(&bar)
+	}
+	return nil
+}
+
+func (a *TradeAgg) addSize(tr *Trade) {
+	b := &a.bar
+	b.Volume += tr.Size
+	b.QuoteVolume += tr.Price * tr.Size
+	b.TradeNum += 1
+	if tr.IsBuy {
+		b.BuyVolume += tr.Size
+	}
+}
+
+/*
+Flush finish bars which end before or at nowMS, call it by timer to close bars without later trades.
+
+完成结束时间不晚于nowMS的bar，可定时调用以完成没有后续成交的bar
+*/
+func (a *TradeAgg) Flush(nowMS int64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if nowMS >= a.stop {
+		a.closeTo(nowMS)
+	}
+}
+
+// closeTo finish the forming bar and add empty bars which end before or at ms
+func (a *TradeAgg) closeTo(ms int64) {
+	if a.stop == 0 {
+		return
+	}
+	if a.active {
+		a.active = false
+		if !a.Intrabar {
+			a.emit(a.bar)
+		}
+	}
+	if a.SkipEmpty {
+		return
+	}
+	e := a.Env
+	price := a.bar.Close
+	for e.barEnd(a.stop) <= ms {
+		a.bar = Kline{Time: a.stop, Open: price, High: price, Low: price, Close: price, Info: math.NaN()}
+		a.stop = e.barEnd(a.stop)
+		a.emit(a.bar)
+	}
+}
+
+func (a *TradeAgg) emit(b Kline) {
+	e := a.Env
+	e.extBar = &b
+	e.OnBar2(b.Time, e.barEnd(b.Time), b.Open, b.High, b.Low, b.Close, b.Volume, b.Info)
+}
+
+/*
+FormingBar return a copy of the unfinished bar, nil if not exist
+
+返回未完成的K线，不存在时返回nil
+*/
+func (a *TradeAgg) FormingBar() *Kline {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if !a.active {
+		return nil
+	}
+	bar := a.bar
+	return &bar
+}
@@ -0,0 +1,119 @@
+package banta
+
+import (
+	"math"
+	"testing"
+)
+
+// minuteTrades generate trades of 1m bars, bars in skips have no trades
+func minuteTrades(barNum int, skips map[int]bool) ([]*Trade, []Kline) {
+	const start = int64(1688169600000)
+	var trades []*Trade
+	var bars []Kline
+	price := 100.0
+	for i := 0; i < barNum; i++ {
+		barMS := start + int64(i)*60000
+		if skips[i] {
+			bars = append(bars, Kline{Time: barMS, Open: price, High: price, Low: price, Close: price})
+			continue
+		}
+		bar := Kline{Time: barMS, Open: math.NaN()}
+		for j := 0; j < 5; j++ {
+			price += math.Sin(float64(i*5+j)) * 2
+			tr := &Trade{Time: barMS + int64(j)*11000 + 500, Price: price, Size: float64(j + 1), IsBuy: j%2 == 0}
+			trades = append(trades, tr)
+			if j == 0 {
+				bar.Open, bar.High, bar.Low = price, price, price
+			}
+			bar.High = max(bar.High, price)
+			bar.Low = min(bar.Low, price)
+			bar.Close = price
+			bar.Volume += tr.Size
+			bar.QuoteVolume += tr.Price * tr.Size
+			bar.TradeNum += 1
+			if tr.IsBuy {
+				bar.BuyVolume += tr.Size
+			}
+		}
+		bars = append(bars, bar)
+	}
+	return trades, bars
+}
+
+func checkTradeBars(t *testing.T, env *BarEnv, bars []Kline) {
+	if env.Close.Len() != len(bars) {
+		t.Fatalf("expect %d bars, got %d", len(bars), env.Close.Len())
+	}
+	for i, b := range bars {
+		j := len(bars) - 1 - i
+		got := []float64{env.Open.Get(j), env.High.Get(j), env.Low.Get(j), env.Close.Get(j), env.Volume.Get(j),
+			env.QuoteVolume.Get(j), env.TradeNum.Get(j), env.BuyVolume.Get(j)}
+		exp := []float64{b.Open, b.High, b.Low, b.Close, b.Volume, b.QuoteVolume, b.TradeNum, b.BuyVolume}
+		for k, v := range exp {
+			if !equalNearly(got[k], v) {
+				t.Fatalf("bar %d field %d: expect %v, got %v", i, k, v, got[k])
+			}
+		}
+	}
+}
+
+func TestTradeAgg(t *testing.T) {
+	trades, bars := minuteTrades(10, map[int]bool{4: true, 5: true})
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1m")
+	agg := NewTradeAgg(env, false)
+	for _, tr := range trades {
+		if err := agg.OnTrade(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if env.BarNum != len(bars)-1 || agg.FormingBar() == nil {
+		t.Fatalf("expect last bar forming, got %d bars", env.BarNum)
+	}
+	agg.Flush(bars[len(bars)-1].Time + 60000)
+	checkTradeBars(t, env, bars)
+	if env.TimeStart != bars[len(bars)-1].Time || env.TimeStop != env.TimeStart+60000 {
+		t.Errorf("bad bar time: %d %d", env.TimeStart, env.TimeStop)
+	}
+	if err := agg.OnTrade(trades[0]); err == nil {
+		t.Error("expect error for old trade")
+	}
+	agg.Flush(env.TimeStop + 3*60000 - 1)
+	if env.BarNum != len(bars)+2 || env.Volume.Get(0) != 0 {
+		t.Errorf("expect empty bars flushed, got %d bars", env.BarNum)
+	}
+
+	env2, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1m")
+	agg = NewTradeAgg(env2, false)
+	agg.SkipEmpty = true
+	for _, tr := range trades {
+		_ = agg.OnTrade(tr)
+	}
+	agg.Flush(bars[len(bars)-1].Time + 60000)
+	if env2.BarNum != len(bars)-2 {
+		t.Errorf("expect empty bars skipped, got %d bars", env2.BarNum)
+	}
+}
+
+func TestTradeAggIntrabar(t *testing.T) {
+	trades, bars := minuteTrades(10, map[int]bool{3: true})
+	env, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1m")
+	agg := NewTradeAgg(env, true)
+	ref, _ := NewBarEnv("binance", "spot", "BTC/USDT", "1m")
+	for _, tr := range trades {
+		if err := agg.OnTrade(tr); err != nil {
+			t.Fatal(err)
+		}
+		if env.Close.Get(0) != tr.Price {
+			t.Fatalf("expect close updated by trade, got %v, %v", env.Close.Get(0), tr.Price)
+		}
+		SMA(env.Close, 3)
+	}
+	checkTradeBars(t, env, bars)
+	for i := range bars {
+		_ = ref.OnKline(&bars[i])
+		SMA(ref.Close, 3)
+	}
+	if val, exp := SMA(env.Close, 3).Get(0), SMA(ref.Close, 3).Get(0); !equalNearly(val, exp) {
+		t.Errorf("expect sma %v, got %v", exp, val)
+	}
+}
@@ -3,10 +3,24 @@ package banta
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 )
 
 var (
 	ErrInvalidSeriesVal = errors.New("invalid val for Series")
+	ErrInvalidExpr      = errors.New("invalid expression")
+	ErrBarGap           = errors.New("missing bars before")
+	ErrInvalidIndArgs   = errors.New("invalid indicator args")
+	ErrInvalidSub       = errors.New("invalid indicator subscription")
+	ErrEnvGroup         = errors.New("EnvGroup error")
+)
+
+// policies for missing bars in BarEnv.OnBar
+const (
+	GapIgnore = iota // 忽略缺失的K线
+	GapError         // 返回ErrBarGap，不添加当前K线
+	GapFill          // 用前一个收盘价填充，成交量为0
+	GapNaN           // 插入值为NaN的K线
 )
 
 type Kline struct {
@@ -17,6 +31,10 @@ type Kline struct {
 	Close  float64
 	Volume float64
 	Info   float64
+	// 以下为可选的扩展字段，通过BarEnv.OnKline传入
+	QuoteVolume float64 // 成交额
+	TradeNum    float64 // 成交笔数
+	BuyVolume   float64 // 主动买入成交量
 }
 
 type BarEnv struct {
@@ -26,7 +44,8 @@ type BarEnv struct {
 	MarketType string
 	Symbol     string
 	TimeFrame  string
-	TFMSecs    int64 //周期的毫秒间隔
+	TFMSecs    int64   //周期的毫秒间隔，日历周期为近似值
+	Frame      *TFrame // 支持日历和时区的周期，为空时按TFMSecs固定间隔
 	BarNum     int
 	MaxCache   int
 	VNum       int
@@ -36,9 +55,29 @@ type BarEnv struct {
 	Close      *Series
 	Volume     *Series
 	Info       *Series
-	Data       sync.Map // map[string]interface{}
-	Items      map[int]*Series
-	LockItems  sync.RWMutex
+	// 扩展序列，首次调用OnKline后不为空
+	QuoteVolume *Series
+	TradeNum    *Series
+	BuyVolume   *Series
+	Data        sync.Map // map[string]interface{}
+	Items       map[int]*Series
+	LockItems   sync.RWMutex
+	GapPolicy   int             // 缺失K线的处理方式：GapIgnore/GapError/GapFill/GapNaN
+	GapNum      int             // 累计插入的缺失K线数量
+	OnGapBar    func(e *BarEnv) // 每个插入的缺失K线后调用，用于计算指标；仍未计算的派生序列补充NaN
+	Intrabar    bool            // 保存每个bar开始前的指标状态，OnBarUpdate需要
+	EvictIdle   int             // 大于0时每EvictIdle个bar自动移除超过EvictIdle个bar未访问的派生序列
+	snapBar     int64           // 最近保存快照的bar开始时间
+	listeners   []barListener
+	subs        []*envSub            // 订阅的指标，按依赖顺序
+	aux         map[string]*auxInput // 外部输入的辅助序列，见Aux
+	lockAux     sync.Mutex
+	extBar      *Kline // 下一个bar的扩展字段，由OnKline设置
+	lockExt     sync.Mutex
+	lockSubs    sync.Mutex
+	lockListen  sync.Mutex
+	resample    *resampler   // 由其他BarEnv重采样得到时不为空
+	uid         atomic.Int64 // 进程内唯一的ID，首次使用时分配，见uniqID
 }
 
 type Series struct {
@@ -49,18 +88,46 @@ type Series struct {
 	Time       int64
 	More       interface{}
 	DupMore    func(interface{}) interface{}
-	Subs       map[string]map[int]*Series // 由此序列派生的；function：hash：object
-	XLogs      map[int]*CrossLog          // 此序列交叉记录
+	Subs       map[string]map[string]*Series // 由此序列派生的；function：ParamKey.Args：object
+	XLogs      map[string]*CrossLog          // 此序列交叉记录，键为比较对象的参数编码
 	LockSubMap map[string]*sync.Mutex
 	LockSub    sync.Mutex
 	LockXLogs  sync.Mutex
 	LockData   sync.RWMutex
+	snap       *seriesSnap   // 当前bar计算前的状态，用于OnBarUpdate回滚
+	usedBar    atomic.Int64  // 最近一次被访问时的BarNum
+	hooks      []*seriesHook // Append后触发的回调
+	auxName    string        // 辅助序列的名称，见BarEnv.Aux
+	lockHooks  sync.Mutex
+}
+
+type seriesSnap struct {
+	time    int64
+	dataLen int
+	more    interface{}
+	xlogs   map[string]xlogSnap
+}
+
+type xlogSnap struct {
+	time    int64
+	prevVal float64
+	histLen int
+}
+
+/*
+ParamKey identify a derived Series by function name and ordered parameters, create it with Key.
+
+派生序列的键，由函数名和有序参数组成，通过Key创建
+*/
+type ParamKey struct {
+	Name string
+	Args string // 编码后的有序参数
 }
 
 type CrossLog struct {
 	Time    int64
 	PrevVal float64
-	Hist    []*XState // 正数表示上穿，负数下穿，绝对值表示BarNum
+	Hist    []*XState // 交叉记录，随MaxCache裁剪
 }
 
 type XState struct {
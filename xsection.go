@@ -0,0 +1,134 @@
+package banta
+
+import (
+	"math"
+	"slices"
+)
+
+// cross-sectional operators for XSection
+const (
+	XRank    = iota // 升序排名，从1开始，相同值取平均排名
+	XPercent        // 排名百分比 rank/n，范围(0, 1]
+	XZScore         // (v - mean) / std，std为总体标准差
+	XDemean         // v - mean
+)
+
+/*
+XSection compute cross-sectional values across symbols for the latest bar, srcs are Series of the same
+indicator in different BarEnv, such as ROC(env.Close, 20) of each symbol. Call it when all BarEnv finished
+the latest bar, such as after EnvGroup.OnBars. Return a Series in each BarEnv, aligned by bar time.
+
+Only srcs whose BarEnv has the latest bar time and the value is not NaN take part in the calculation,
+the result is NaN for others. BarEnv with missing bars get NaN for their own current bar.
+Results are cached on srcs, so a Series should only be used in one group.
+
+mode: XRank, XPercent, XZScore, XDemean
+
+横截面计算：对多个品种同一指标（如各品种的ROC(close, 20)）在最新bar上计算排名、百分比、z-score或去均值，
+需在所有BarEnv处理完最新bar后调用（如EnvGroup.OnBars之后）。返回每个BarEnv中按bar时间对齐的序列。
+只有BarEnv处于最新时间且值非NaN的参与计算，其他结果为NaN；缺失最新bar的品种在自己的当前bar得到NaN。
+结果缓存在srcs上，同一序列只应用于一个分组
+*/
+func XSection(srcs []*Series, mode int) []*Series {
+	key := Key("_xsec", mode)
+	var barMS int64
+	for _, s := range srcs {
+		barMS = max(barMS, s.Env.TimeStart)
+	}
+	vals := make([]float64, len(srcs))
+	valid := make([]float64, 0, len(srcs))
+	for i, s := range srcs {
+		vals[i] = math.NaN()
+		if s.Env.TimeStart == barMS {
+			vals[i] = s.Get(0)
+		}
+		if !math.IsNaN(vals[i]) {
+			valid = append(valid, vals[i])
+		}
+	}
+	calc := xsectCalc(valid, mode)
+	res := make([]*Series, len(srcs))
+	for i, s := range srcs {
+		out := s.ToKey(key)
+		res[i] = out
+		if out.Cached() {
+			continue
+		}
+		out.LockData.Lock()
+		if !out.Cached() {
+			if math.IsNaN(vals[i]) {
+				out.Append(math.NaN())
+			} else {
+				out.Append(calc(vals[i]))
+			}
+		}
+		out.LockData.Unlock()
+	}
+	return res
+}
+
+// xsectCalc return a function mapping a valid value to cross-sectional result
+func xsectCalc(valid []float64, mode int) func(v float64) float64 {
+	num := float64(len(valid))
+	switch mode {
+	case XRank, XPercent:
+		sorted := slices.Clone(valid)
+		slices.Sort(sorted)
+		return func(v float64) float64 {
+			// 相同值取平均排名
+			lo, _ := slices.BinarySearch(sorted, v)
+			hi := lo
+			for hi < len(sorted) && sorted[hi] == v {
+				hi++
+			}
+			rank := float64(lo+hi+1) / 2
+			if mode == XPercent {
+				return rank / num
+			}
+			return rank
+		}
+	}
+	sumVal := 0.0
+	for _, v := range valid {
+		sumVal += v
+	}
+	mean := sumVal / num
+	if mode == XDemean {
+		return func(v float64) float64 {
+			return v - mean
+		}
+	}
+	sumSq := 0.0
+	for _, v := range valid {
+		sumSq += (v - mean) * (v - mean)
+	}
+	std := math.Sqrt(sumSq / num)
+	return func(v float64) float64 {
+		if std == 0 {
+			return 0
+		}
+		return (v - mean) / std
+	}
+}
+
+/*
+XSection compute cross-sectional values of calc across all BarEnv in group, see XSection.
+Call it after OnBars or WaitTime. Return result Series keyed by EnvKey.
+
+对组内所有BarEnv计算calc的横截面值，见XSection。需在OnBars或WaitTime之后调用，返回结果的键为EnvKey
+*/
+func (g *EnvGroup) XSection(calc func(e *BarEnv) *Series, mode int) map[string]*Series {
+	keys := g.Keys()
+	srcs := make([]*Series, 0, len(keys))
+	for _, k := range keys {
+		if env := g.Get(k); env != nil && env.Close != nil {
+			srcs = append(srcs, calc(env))
+		}
+	}
+	outs := XSection(srcs, mode)
+	res := make(map[string]*Series, len(outs))
+	for _, s := range outs {
+		res[s.Env.String()] = s
+	}
+	return res
+}
@@ -0,0 +1,108 @@
+package banta
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/banbox/banta/tav"
+)
+
+func TestXSection(t *testing.T) {
+	const envNum, missBar = 5, 10
+	g := NewEnvGroup(3, nil)
+	defer g.Close()
+	keys := make([]string, envNum)
+	rocs := make([][]float64, envNum)
+	bars := make([][]Kline, envNum)
+	for i := range keys {
+		env, _ := g.Env("binance", "spot", fmt.Sprintf("C%d/USDT", i), "1d")
+		keys[i] = env.String()
+		for j, k := range DataKline {
+			if i == envNum-1 && j == missBar {
+				// 最后一个品种缺失一个bar
+				continue
+			}
+			k.Close += float64(i * j)
+			if i == 0 && j%7 == 0 {
+				k.Close = math.NaN()
+			}
+			bars[i] = append(bars[i], k)
+		}
+		_, _, _, c, _, _ := extractOHLCV(bars[i])
+		rocs[i] = tav.ROC(c, 3)
+	}
+	calc := func(e *BarEnv) *Series {
+		return ROC(e.Close, 3)
+	}
+	idx := make([]int, envNum)
+	for j, k := range DataKline {
+		batch := make(map[string]*Kline)
+		var vals []float64
+		for i, key := range keys {
+			if idx[i] < len(bars[i]) && bars[i][idx[i]].Time == k.Time {
+				batch[key] = &bars[i][idx[i]]
+				vals = append(vals, rocs[i][idx[i]])
+			} else {
+				vals = append(vals, math.NaN())
+			}
+		}
+		if err := g.OnBars(batch); err != nil {
+			t.Fatal(err)
+		}
+		results := make([]map[string]*Series, 4)
+		for mode := range results {
+			results[mode] = g.XSection(calc, mode)
+		}
+		for i, key := range keys {
+			if _, ok := batch[key]; !ok {
+				continue
+			}
+			idx[i] += 1
+			expects := xsectExpect(vals, vals[i])
+			for mode, res := range results {
+				if val := res[key].Get(0); !equalNearly(val, expects[mode]) {
+					t.Fatalf("bar %d %s mode %d: expect %v, got %v", j, key, mode, expects[mode], val)
+				}
+			}
+		}
+	}
+	env := g.Get(keys[envNum-1])
+	res := XSection([]*Series{calc(env)}, XRank)[0]
+	if res.Len() != env.Close.Len() {
+		t.Errorf("expect result aligned with bars, got %d, %d", res.Len(), env.Close.Len())
+	}
+}
+
+// xsectExpect return expected rank, percent, zscore and demean of v in vals
+func xsectExpect(vals []float64, v float64) []float64 {
+	nan := math.NaN()
+	if math.IsNaN(v) {
+		return []float64{nan, nan, nan, nan}
+	}
+	var less, equal, num, sumVal, sumSq float64
+	for _, x := range vals {
+		if math.IsNaN(x) {
+			continue
+		}
+		num += 1
+		sumVal += x
+		if x < v {
+			less += 1
+		} else if x == v {
+			equal += 1
+		}
+	}
+	mean := sumVal / num
+	for _, x := range vals {
+		if !math.IsNaN(x) {
+			sumSq += (x - mean) * (x - mean)
+		}
+	}
+	rank := less + (equal+1)/2
+	zscore := 0.0
+	if std := math.Sqrt(sumSq / num); std > 0 {
+		zscore = (v - mean) / std
+	}
+	return []float64{rank, rank / num, zscore, v - mean}
+}